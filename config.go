@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// config is the content of a -config file. Every key is named after the
+// flag it stands in for, flags given on the command line take precedence.
+// Modes such as -root or -verify, passwords and -seed aren't settings a
+// checked-in file should carry, so they have no key.
+type config struct {
+	Out    *string `json:"out"`
+	CACert *string `json:"ca-cert"`
+	CAKey  *string `json:"ca-key"`
+
+	Org             *string     `json:"org"`
+	CN              *string     `json:"cn"`
+	CNFromSPIFFE    *configBool `json:"cn-from-spiffe"`
+	AllowLongCN     *configBool `json:"allow-long-cn"`
+	SubjectDER      *string     `json:"subject-der"`
+	DBUser          *string     `json:"db-user"`
+	DeviceID        *string     `json:"device-id"`
+	DNS             configList  `json:"dns"`
+	IP              configList  `json:"ip"`
+	IPCIDR          configList  `json:"ip-cidr"`
+	Email           configList  `json:"email"`
+	URI             configList  `json:"uri"`
+	AllowInvalidSAN *configBool `json:"allow-invalid-san"`
+	Names           configList  `json:"name"`
+
+	SPIFFE       *configBool `json:"spiffe"`
+	SPIFFEDomain *string     `json:"spiffe-domain"`
+	SPIFFEID     *string     `json:"spiffe-id"`
+	K8sNamespace *string     `json:"k8s-namespace"`
+	K8sSA        *string     `json:"k8s-sa"`
+
+	LeafTTL        *string     `json:"leaf-ttl"`
+	CATTL          *string     `json:"ca-ttl"`
+	Backdate       *string     `json:"backdate"`
+	ValidityJitter *string     `json:"validity-jitter"`
+	AlignUTCDay    *configBool `json:"align-utc-day"`
+	NoExpiry       *configBool `json:"no-expiry"`
+	NotBefore      *string     `json:"not-before"`
+	NotAfter       *string     `json:"not-after"`
+
+	KeyType    *string     `json:"key-type"`
+	KeyFormat  *string     `json:"key-format"`
+	RSABits    *configInt  `json:"rsa-bits"`
+	CSRSigAlg  *string     `json:"csr-sig-alg"`
+	SerialBits *configInt  `json:"serial-bits"`
+	FIPS       *configBool `json:"fips"`
+	Strict     *configBool `json:"strict"`
+	WarnWeak   *configBool `json:"warn-weak"`
+
+	Usage      *string     `json:"usage"`
+	Profile    *string     `json:"profile"`
+	MustStaple *configBool `json:"must-staple"`
+	AKIMode    *string     `json:"aki-mode"`
+	CASKI      *string     `json:"ca-ski"`
+	AKI        *string     `json:"aki"`
+
+	PermittedDNS configList `json:"permitted-dns"`
+	ExcludedDNS  configList `json:"excluded-dns"`
+	PermittedURI configList `json:"permitted-uri"`
+	CRLURLs      configList `json:"crl-url"`
+	OCSPURLs     configList `json:"ocsp-url"`
+	CRLTTL       *string    `json:"crl-ttl"`
+
+	Chain           *configBool `json:"chain"`
+	KeyWithCA       *configBool `json:"key-with-ca"`
+	CertOnly        *configBool `json:"cert-only"`
+	Overwrite       *configBool `json:"overwrite"`
+	Force           *configBool `json:"force"`
+	CertDir         *string     `json:"cert-dir"`
+	KeyDir          *string     `json:"key-dir"`
+	NameTemplate    *string     `json:"name-template"`
+	KeyNameTemplate *string     `json:"key-name-template"`
+	TimestampDir    *configBool `json:"timestamp-dir"`
+	Keep            *configInt  `json:"keep"`
+	Ledger          *configBool `json:"ledger"`
+	TextfileOut     *string     `json:"textfile-out"`
+
+	Nginx        *configBool `json:"nginx"`
+	Envoy        *configBool `json:"envoy"`
+	Bundle       *configBool `json:"bundle"`
+	PFX          *configBool `json:"pfx"`
+	DockerSecret *configBool `json:"docker-secret"`
+	TrustedCA    *configBool `json:"trusted-ca"`
+
+	FingerprintFormat *string     `json:"fingerprint-format"`
+	Quiet             *configBool `json:"quiet"`
+	JSON              *configBool `json:"json"`
+}
+
+// configInt is an integer config value. YAML scalars are read as strings,
+// so a quoted number is accepted as well.
+type configInt int
+
+func (n *configInt) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%s isn't an integer", data)
+	}
+
+	*n = configInt(v)
+	return nil
+}
+
+// configBool is a boolean config value, quoted or not.
+type configBool bool
+
+func (b *configBool) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false", data)
+	}
+
+	*b = configBool(v)
+	return nil
+}
+
+// configList is the value of a repeatable flag, a list or a single string.
+type configList []string
+
+func (l *configList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = configList{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s must be a string or a list of strings", data)
+	}
+
+	*l = list
+	return nil
+}
+
+// loadConfig reads the JSON or YAML config file at path, by its extension.
+// Unknown keys and values of the wrong type are an error, so typos don't go
+// unnoticed.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read config, %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		m, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse %q, %w", path, err)
+		}
+
+		if data, err = json.Marshal(m); err != nil {
+			return nil, fmt.Errorf("couldn't parse %q, %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("config %q must be a .json, .yaml or .yml file", path)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("couldn't parse %q, %w", path, err)
+	}
+
+	return &c, nil
+}
+
+// flagValues returns the values c sets, keyed by flag name. Repeatable flags
+// get one value per occurrence.
+func (c *config) flagValues() map[string][]string {
+	values := map[string][]string{}
+
+	strs := map[string]*string{
+		"out": c.Out, "ca-cert": c.CACert, "ca-key": c.CAKey,
+		"org": c.Org, "cn": c.CN, "subject-der": c.SubjectDER, "db-user": c.DBUser, "device-id": c.DeviceID,
+		"spiffe-domain": c.SPIFFEDomain, "spiffe-id": c.SPIFFEID, "k8s-namespace": c.K8sNamespace, "k8s-sa": c.K8sSA,
+		"leaf-ttl": c.LeafTTL, "ca-ttl": c.CATTL, "backdate": c.Backdate, "validity-jitter": c.ValidityJitter,
+		"not-before": c.NotBefore, "not-after": c.NotAfter,
+		"key-type": c.KeyType, "key-format": c.KeyFormat, "csr-sig-alg": c.CSRSigAlg,
+		"usage": c.Usage, "profile": c.Profile, "aki-mode": c.AKIMode, "ca-ski": c.CASKI, "aki": c.AKI, "crl-ttl": c.CRLTTL,
+		"cert-dir": c.CertDir, "key-dir": c.KeyDir, "name-template": c.NameTemplate, "key-name-template": c.KeyNameTemplate,
+		"textfile-out": c.TextfileOut, "fingerprint-format": c.FingerprintFormat,
+	}
+	for name, v := range strs {
+		if v != nil {
+			values[name] = []string{*v}
+		}
+	}
+
+	lists := map[string]configList{
+		"dns": c.DNS, "ip": c.IP, "ip-cidr": c.IPCIDR, "email": c.Email, "uri": c.URI, "name": c.Names,
+		"permitted-dns": c.PermittedDNS, "excluded-dns": c.ExcludedDNS, "permitted-uri": c.PermittedURI,
+		"crl-url": c.CRLURLs, "ocsp-url": c.OCSPURLs,
+	}
+	for name, v := range lists {
+		if v != nil {
+			values[name] = v
+		}
+	}
+
+	bools := map[string]*configBool{
+		"cn-from-spiffe": c.CNFromSPIFFE, "allow-long-cn": c.AllowLongCN, "allow-invalid-san": c.AllowInvalidSAN,
+		"spiffe": c.SPIFFE, "align-utc-day": c.AlignUTCDay, "no-expiry": c.NoExpiry, "fips": c.FIPS, "strict": c.Strict, "warn-weak": c.WarnWeak,
+		"must-staple": c.MustStaple, "chain": c.Chain, "key-with-ca": c.KeyWithCA, "cert-only": c.CertOnly,
+		"overwrite": c.Overwrite, "force": c.Force, "timestamp-dir": c.TimestampDir,
+		"ledger": c.Ledger, "nginx": c.Nginx, "envoy": c.Envoy, "bundle": c.Bundle, "pfx": c.PFX,
+		"docker-secret": c.DockerSecret, "trusted-ca": c.TrustedCA, "quiet": c.Quiet, "json": c.JSON,
+	}
+	for name, v := range bools {
+		if v != nil {
+			values[name] = []string{strconv.FormatBool(bool(*v))}
+		}
+	}
+
+	for name, v := range map[string]*configInt{"rsa-bits": c.RSABits, "serial-bits": c.SerialBits, "keep": c.Keep} {
+		if v != nil {
+			values[name] = []string{strconv.Itoa(int(*v))}
+		}
+	}
+
+	return values
+}
+
+// applyConfig sets the flags of fs from the config file at path, except the
+// ones given on the command line, which win. A repeatable flag given on the
+// command line replaces the file's list instead of adding to it.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	c, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	values := c.flagValues()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if given[name] {
+			continue
+		}
+
+		for _, v := range values[name] {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("config %q: invalid value %q for %s: %w", path, v, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseYAML parses the YAML subset a config needs: a flat mapping of
+// scalars, flow sequences ([a, b]) and block sequences ("- a" lines).
+// Anchors, multi-line strings and nested mappings aren't supported.
+func parseYAML(data []byte) (map[string]any, error) {
+	m := map[string]any{}
+	// key of the block sequence the following "- " lines belong to
+	var list string
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = stripYAMLComment(line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok && (item == "" || item[0] == ' ') {
+			if list == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", i+1)
+			}
+			m[list] = append(m[list].([]any), yamlScalar(strings.TrimSpace(item)))
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested mappings aren't supported", i+1)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: %q is given more than once", i+1, key)
+		}
+
+		list = ""
+		switch {
+		case value == "":
+			list = key
+			m[key] = []any{}
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			items := []any{}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, yamlScalar(item))
+				}
+			}
+			m[key] = items
+		default:
+			m[key] = yamlScalar(value)
+		}
+	}
+
+	return m, nil
+}
+
+// stripYAMLComment removes a # comment that starts the line or follows a
+// space, outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// yamlScalar converts a plain or quoted YAML scalar to its string, nil for
+// null. Plain values aren't typed, the flag they set parses them.
+func yamlScalar(s string) any {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+
+	if s == "null" || s == "~" {
+		return nil
+	}
+
+	return s
+}
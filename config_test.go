@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	data := []byte(`# tlsgen config
+---
+org: 123
+cn: "web # not a comment"
+dns:
+  - web.local.dev
+  - 'it''s'
+ip: [127.0.0.1, ::1] # trailing comment
+chain: true
+spiffe-id: ~
+`)
+
+	got, err := parseYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"org":       "123",
+		"cn":        "web # not a comment",
+		"dns":       []any{"web.local.dev", "it's"},
+		"ip":        []any{"127.0.0.1", "::1"},
+		"chain":     "true",
+		"spiffe-id": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, data := range []string{
+		"- item\n",
+		"out:\n  nested: true\n",
+		"org: a\norg: b\n",
+		"no value\n",
+	} {
+		if _, err := parseYAML([]byte(data)); err == nil {
+			t.Errorf("%q was accepted", data)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	for _, tc := range []struct{ name, content string }{
+		{"tlsgen.yaml", "org: 123\nrsa-bits: 4096\nchain: true\ndns: [a.dev, b.dev]\ncn: web\n"},
+		{"tlsgen.json", `{"org": "123", "rsa-bits": 4096, "chain": true, "dns": ["a.dev", "b.dev"], "cn": "web"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			org := fs.String("org", "", "")
+			bits := fs.Int("rsa-bits", 2048, "")
+			chain := fs.Bool("chain", false, "")
+			cn := fs.String("cn", "", "")
+			var dns []string
+			fs.Var((*stringSlice)(&dns), "dns", "")
+			if err := fs.Parse([]string{"-cn", "api"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyConfig(fs, path); err != nil {
+				t.Fatal(err)
+			}
+
+			if *org != "123" || *bits != 4096 || !*chain || !reflect.DeepEqual(dns, []string{"a.dev", "b.dev"}) {
+				t.Fatalf("got org %q, rsa-bits %d, chain %t, dns %v", *org, *bits, *chain, dns)
+			}
+			if *cn != "api" {
+				t.Fatalf("config replaced -cn given on the command line with %q", *cn)
+			}
+		})
+	}
+}
+
+func TestApplyConfigUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tlsgen.yaml")
+	if err := os.WriteFile(path, []byte("orgg: Acme\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("org", "", "")
+	if err := applyConfig(fs, path); err == nil {
+		t.Fatal("unknown key was accepted")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct{ name, content string }{
+		{"mode.yaml", "root: true\n"},
+		{"password.json", `{"pfx-password": "secret"}`},
+		{"int.yaml", "rsa-bits: many\n"},
+		{"bool.yaml", "chain: sometimes\n"},
+		{"string.json", `{"org": 123}`},
+		{"list.json", `{"dns": [1, 2]}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := loadConfig(path); err == nil {
+				t.Fatalf("%q was accepted", tc.content)
+			}
+		})
+	}
+}
+
+func TestLoadConfigScalarList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tlsgen.yaml")
+	if err := os.WriteFile(path, []byte("dns: web.local.dev\nkeep: \"3\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"dns": {"web.local.dev"}, "keep": {"3"}}
+	if got := c.flagValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestConfigKeysAreFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts := newOptions()
+	(&modes{}).registerFlags(fs, &opts)
+
+	typ := reflect.TypeOf(config{})
+	for i := 0; i < typ.NumField(); i++ {
+		if name := typ.Field(i).Tag.Get("json"); fs.Lookup(name) == nil {
+			t.Errorf("config key %q isn't a flag", name)
+		}
+	}
+}
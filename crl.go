@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const (
+	rootCRLFilePath         = "ca/root.crl"
+	intermediateCRLFilePath = "intermediate/intermediate.crl"
+)
+
+// generateCRL writes a CRL revoking the -revoke serials and those listed in
+// -revoke-file, signed by the CA leaves are signed by, next to that CA.
+func generateCRL(opts *options) error {
+	revoked := opts.revoked
+	if opts.revokeFile != "" {
+		serials, err := readSerials(opts.revokeFile)
+		if err != nil {
+			return err
+		}
+		revoked = append(revoked, serials...)
+	}
+
+	ca, err := getIssuer(opts.caKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	der, err := tlsgen.GenerateCRL(ca, revoked, &opts.Options)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(tlsDir, rootCRLFilePath)
+	if len(ca.Chain) > 1 {
+		path = filepath.Join(tlsDir, intermediateCRLFilePath)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return fmt.Errorf("generated CRL contains errors, %w", err)
+	}
+
+	if err := writePEM(path, 0644, &pem.Block{Type: "X509 CRL", Bytes: der}); err != nil {
+		return err
+	}
+
+	opts.logger.Infof("CRL of %s revoking %d certificates written to %q, next update on %s\n",
+		ca.Cert.Subject, len(revoked), path, crl.NextUpdate.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// readSerials reads the serial numbers in path, one per line in the -revoke
+// format. Empty lines and lines starting with # are skipped.
+func readSerials(path string) ([]*big.Int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read revoked serials, %w", err)
+	}
+
+	var serials []*big.Int
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		serial, err := parseSerial(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		serials = append(serials, serial)
+	}
+
+	return serials, scanner.Err()
+}
+
+// validateCRL rejects -revoke and -revoke-file without -crl.
+func (o *options) validateCRL() error {
+	if !o.crl && (len(o.revoked) > 0 || o.revokeFile != "") {
+		return fmt.Errorf("-revoke and -revoke-file require -crl")
+	}
+
+	return nil
+}
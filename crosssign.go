@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// crossCertPath returns where the cross-signed copy of the certificate at
+// certPath is written, e.g. client/client-cross.pem.
+func crossCertPath(certPath string) string {
+	ext := filepath.Ext(certPath)
+	return strings.TrimSuffix(certPath, ext) + "-cross" + ext
+}
+
+// crossSign signs cert, just written to certPath, with the -ca-cert2 CA as
+// well and writes the result next to it. The cross-signed certificate is
+// followed by the intermediates of the second CA, and its root with -chain.
+// It shares the key of cert, no key file is written.
+func crossSign(opts *options, cert *x509.Certificate, certPath string) error {
+	ca, err := loadCA(opts.crossCert, newCASigner(opts.crossKey, opts.caKeyPassword))
+	if err != nil {
+		return fmt.Errorf("an error occured when attempting to load the -ca-cert2 CA, %w", err)
+	}
+
+	der, err := tlsgen.CrossSign(ca, cert, &opts.Options)
+	if err != nil {
+		return err
+	}
+
+	crossed, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("cross-signed certificate contains errors, %w", err)
+	}
+
+	blocks := []*pem.Block{{Type: "CERTIFICATE", Bytes: der}}
+	chain := intermediates(ca)
+	if opts.chain {
+		chain = append(chain, ca.Root())
+	}
+	for _, der := range chain {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	path := crossCertPath(certPath)
+	if err := writePEM(path, 0644, blocks...); err != nil {
+		return err
+	}
+
+	logFingerprints(opts.logger, []certMetric{{role: "cross-signed", path: path, cert: crossed}}, opts.fingerprintFormat)
+	opts.logger.Infof("Cross-signed %s by %s in %q\n", cert.Subject, ca.Cert.Subject, path)
+	return nil
+}
+
+// validateCrossSign makes sure -ca-cert2 and -ca-key2 come together and are
+// only used where a single leaf or intermediate is written to a file.
+func (o *options) validateCrossSign() error {
+	if (o.crossCert == "") != (o.crossKey == "") {
+		return fmt.Errorf("-ca-cert2 and -ca-key2 must be given together")
+	}
+
+	if o.crossCert == "" {
+		return nil
+	}
+
+	conflicts := []conflict{
+		{o.count > 1, "-count"},
+		{len(o.names) > 0, "-name"},
+		{o.stdout, "-stdout"},
+		{o.csr, "-csr"},
+		{o.signCSR != "", "-sign-csr"},
+		{o.selfSigned, "-self-signed"},
+		{o.crl, "-crl"},
+		{o.ocspResponse != "", "-ocsp-response"},
+	}
+	return conflictError("-ca-cert2 can't be combined with", conflicts)
+}
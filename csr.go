@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// csrSignatureAlgorithms are the values -csr-sig-alg accepts.
+var csrSignatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+	x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+	x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
+	x509.PureEd25519,
+}
+
+// parseCSRSignatureAlgorithm looks up a signature algorithm by the name Go
+// prints for it, e.g. SHA384-RSA or ECDSA-SHA256.
+func parseCSRSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	names := make([]string, 0, len(csrSignatureAlgorithms))
+	for _, alg := range csrSignatureAlgorithms {
+		if strings.EqualFold(alg.String(), name) {
+			return alg, nil
+		}
+		names = append(names, alg.String())
+	}
+
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unknown signature algorithm %q, must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// generateCSR writes a new leaf key and a certificate signing request for it,
+// carrying the subject and SANs the leaf certificate would get, for signing
+// by an external CA.
+func generateCSR(opts *options) error {
+	if err := createCertDir(opts.logger); err != nil {
+		return err
+	}
+
+	if err := createLeafDirs(opts); err != nil {
+		return err
+	}
+
+	key, err := tlsgen.GenerateKey(&opts.Options)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tlsgen.LeafTemplate(&opts.Options)
+	if err != nil {
+		return err
+	}
+
+	tpl := &x509.CertificateRequest{
+		Subject:            cert.Subject,
+		RawSubject:         cert.RawSubject,
+		DNSNames:           cert.DNSNames,
+		IPAddresses:        cert.IPAddresses,
+		EmailAddresses:     cert.EmailAddresses,
+		URIs:               cert.URIs,
+		SignatureAlgorithm: opts.csrSigAlg,
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, tpl, key)
+	if err != nil {
+		return fmt.Errorf("couldn't create certificate request, %w", err)
+	}
+
+	keyBlock, err := tlsgen.MarshalPrivateKeyAs(key, keyFormat)
+	if err != nil {
+		return err
+	}
+
+	keyBlock, err = tlsgen.EncryptKeyBlock(keyBlock, opts.keyPassword)
+	if err != nil {
+		return err
+	}
+
+	certPath, keyPath := leafPaths(opts)
+	csrPath := strings.TrimSuffix(certPath, filepath.Ext(certPath)) + ".csr"
+
+	if err := saveKey(keyBlock, keyPath); err != nil {
+		return err
+	}
+
+	if err := writePEM(csrPath, 0644, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}); err != nil {
+		return err
+	}
+
+	opts.logger.Infof("Certificate request written to %q\n", csrPath)
+	return nil
+}
+
+// signCSR issues a leaf for the certificate signing request in opts.signCSR,
+// signed by the local CA, and writes it to the regular leaf location. The
+// leaf key stays with the requester and isn't touched.
+func signCSR(opts *options) error {
+	data, err := os.ReadFile(opts.signCSR)
+	if err != nil {
+		return fmt.Errorf("couldn't read certificate request, %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return fmt.Errorf("no CERTIFICATE REQUEST PEM block found in %q", opts.signCSR)
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("couldn't parse certificate request %q, %w", opts.signCSR, err)
+	}
+
+	ca, err := getIssuer(opts.caKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tlsgen.SignCSR(ca, csr, &opts.Options)
+	if err != nil {
+		return err
+	}
+
+	// checked before anything is written, as generateCertKey does
+	if err := checkServerAuthValidity(cert); err != nil {
+		if opts.strict {
+			return err
+		}
+		opts.logger.Warnf("%s\n", err)
+	}
+
+	certs := append([][]byte{cert.Raw}, intermediates(ca)...)
+	if opts.chain {
+		certs = append(certs, ca.Root())
+	}
+	if opts.stdout {
+		return writeStdout(os.Stdout, certs, nil)
+	}
+
+	if err := createCertDir(opts.logger); err != nil {
+		return err
+	}
+
+	if err := createLeafDirs(opts); err != nil {
+		return err
+	}
+
+	certPath, _ := leafPaths(opts)
+	if err := saveWithPaths(certs, nil, certPath, ""); err != nil {
+		return err
+	}
+
+	if opts.ledger {
+		if err := recordIssued(cert); err != nil {
+			return err
+		}
+	}
+
+	metrics := []certMetric{{role: "leaf", path: certPath, cert: cert}}
+	logFingerprints(opts.logger, metrics, opts.fingerprintFormat)
+
+	if opts.json {
+		if err := printSummary(os.Stdout, metrics); err != nil {
+			return err
+		}
+	}
+
+	opts.logger.Infof("Certificate for %q written to %q\n", opts.signCSR, certPath)
+	return nil
+}
+
+// validateSignCSR rejects options that need the leaf key, which -sign-csr
+// never sees, or that issue more than the one requested certificate.
+func (o *options) validateSignCSR() error {
+	if o.signCSR == "" {
+		return nil
+	}
+
+	conflicts := append([]conflict{
+		{o.csr, "-csr"},
+		{o.count > 1, "-count"},
+		{o.certOnly, "-cert-only"},
+		{o.timestampDir, "-timestamp-dir"},
+		{o.textfileOut != "", "-textfile-out"},
+	}, o.layoutConflicts()...)
+
+	return conflictError("-sign-csr only writes the requested certificate and can't be combined with", conflicts)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// dryRun prints the template of the certificate the flags describe, the root
+// with -root, the intermediate with -intermediate and the leaf otherwise,
+// without generating a key or writing anything. Every leaf of a -count or
+// -name run is printed under its own heading.
+func dryRun(w io.Writer, opts *options, root, intermediate bool) error {
+	switch {
+	case root:
+		tpl, err := tlsgen.RootTemplate(&opts.Options)
+		if err != nil {
+			return err
+		}
+		return printTemplate(w, tpl)
+	case intermediate:
+		tpl, err := tlsgen.IntermediateTemplate(&opts.Options)
+		if err != nil {
+			return err
+		}
+		if err := printTemplate(w, tpl); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "Not After is capped at the root's when the intermediate is issued.")
+		return nil
+	}
+
+	if err := opts.loadRenewal(); err != nil {
+		return err
+	}
+
+	if opts.count <= 1 && len(opts.names) == 0 {
+		tpl, err := tlsgen.LeafTemplate(&opts.Options)
+		if err != nil {
+			return err
+		}
+		return printTemplate(w, tpl)
+	}
+
+	for i, leafOpts := range bulkLeaves(opts) {
+		tpl, err := tlsgen.LeafTemplate(&leafOpts.Options)
+		if err != nil {
+			return fmt.Errorf("leaf %s: %w", leafOpts.bulkLabel(), err)
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Leaf %s:\n", leafOpts.bulkLabel())
+		if err := printTemplate(w, tpl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printTemplate prints the fields of the unsigned certificate tpl that the
+// flags control.
+func printTemplate(w io.Writer, tpl *x509.Certificate) error {
+	subject := tpl.Subject
+	if len(tpl.RawSubject) > 0 {
+		// set by -subject-der and -renew, takes precedence over Subject
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(tpl.RawSubject, &rdns); err != nil {
+			return fmt.Errorf("couldn't parse the subject, %w", err)
+		}
+		subject.FillFromRDNSequence(&rdns)
+	}
+
+	fmt.Fprintf(w, "Subject:    %s\n", subject)
+	fmt.Fprintf(w, "Not Before: %s\n", tpl.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "Not After:  %s\n", tpl.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "CA:         %t\n", tpl.IsCA)
+	if tpl.IsCA {
+		fmt.Fprintf(w, "Path Len:   %s\n", pathLen(tpl))
+	}
+	printNamesAndUsages(w, tpl)
+
+	return nil
+}
+
+// pathLen describes the basic constraints path length of the CA cert.
+func pathLen(cert *x509.Certificate) string {
+	if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+		return fmt.Sprint(cert.MaxPathLen)
+	}
+
+	return "unlimited"
+}
+
+// validateDryRun rejects modes that don't issue a certificate from a
+// template -dry-run could print.
+func (o *options) validateDryRun() error {
+	if !o.dryRun {
+		return nil
+	}
+
+	conflicts := []conflict{
+		{o.csr, "-csr"},
+		{o.signCSR != "", "-sign-csr"},
+		{o.crl, "-crl"},
+		{o.ocspResponse != "", "-ocsp-response"},
+	}
+	return conflictError("-dry-run can't be combined with", conflicts)
+}
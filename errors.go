@@ -0,0 +1,17 @@
+package main
+
+import "github.com/rumenvasilev/tlsgen-dev/tlsgen"
+
+// Sentinel errors returned when loading or validating CA material. Use
+// errors.Is to branch on them, the returned errors usually wrap extra context.
+var (
+	// ErrNotCA is returned when a certificate expected to be a CA isn't one.
+	ErrNotCA = tlsgen.ErrNotCA
+	// ErrCAExpired is returned when a CA certificate is past its NotAfter.
+	ErrCAExpired = tlsgen.ErrCAExpired
+	// ErrCANotYetValid is returned when a CA certificate is before its NotBefore.
+	ErrCANotYetValid = tlsgen.ErrCANotYetValid
+	// ErrKeyMismatch is returned when a private key doesn't belong to the
+	// certificate it was loaded with.
+	ErrKeyMismatch = tlsgen.ErrKeyMismatch
+)
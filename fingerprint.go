@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Values of -fingerprint-format.
+const (
+	fingerprintHex    = "hex"
+	fingerprintBase64 = "base64"
+)
+
+// printCAFingerprints prints the fingerprints of the root CA at path in the
+// forms certificate and public key pinning mechanisms expect.
+func printCAFingerprints(w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read %q, %w", path, err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %q, %w", path, err)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificate found in %q", path)
+	}
+
+	printFingerprints(w, certs[0])
+	return nil
+}
+
+// printFingerprints prints the SHA-256 hashes of the whole certificate and of
+// its SubjectPublicKeyInfo, the latter being what pin-sha256 pins.
+func printFingerprints(w io.Writer, cert *x509.Certificate) {
+	certSum := sha256.Sum256(cert.Raw)
+	spkiSum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	fmt.Fprintf(w, "SHA-256:            %s\n", colonHex(certSum[:]))
+	fmt.Fprintf(w, "SHA-256 (base64):   %s\n", base64.StdEncoding.EncodeToString(certSum[:]))
+	fmt.Fprintf(w, "SPKI SHA-256:       %s\n", colonHex(spkiSum[:]))
+	fmt.Fprintf(w, "pin-sha256:         %q\n", base64.StdEncoding.EncodeToString(spkiSum[:]))
+}
+
+// logFingerprints logs the SHA-256 hashes of every certificate in metrics,
+// of the whole certificate and of its SubjectPublicKeyInfo, in format.
+func logFingerprints(l *logger, metrics []certMetric, format string) {
+	for _, m := range metrics {
+		certSum := sha256.Sum256(m.cert.Raw)
+		spkiSum := sha256.Sum256(m.cert.RawSubjectPublicKeyInfo)
+
+		l.Infof("%s %s: SHA-256 %s, SPKI SHA-256 %s\n", m.role, m.cert.Subject,
+			formatFingerprint(certSum[:], format), formatFingerprint(spkiSum[:], format))
+	}
+}
+
+// formatFingerprint renders sum as colon separated hex or as base64, the
+// encoding pin-sha256 and SSH style fingerprints use.
+func formatFingerprint(sum []byte, format string) string {
+	if format == fingerprintBase64 {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+
+	return colonHex(sum)
+}
+
+// colonHex renders b as uppercase hex pairs separated by colons, the way
+// openssl prints fingerprints.
+func colonHex(b []byte) string {
+	pairs := make([]string, len(b))
+	for i := range b {
+		pairs[i] = strings.ToUpper(hex.EncodeToString(b[i : i+1]))
+	}
+
+	return strings.Join(pairs, ":")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// stringSlice is a flag.Value collecting every occurrence of a repeatable flag.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// parseSerial parses a serial number given in decimal, as 0x prefixed hex or
+// as colon separated hex bytes the way openssl prints serials, e.g. 01:a2.
+func parseSerial(v string) (*big.Int, error) {
+	serial, ok := new(big.Int), false
+	if strings.Contains(v, ":") {
+		hex := strings.ReplaceAll(strings.TrimPrefix(strings.TrimPrefix(v, "0x"), "0X"), ":", "")
+		_, ok = serial.SetString(hex, 16)
+	} else {
+		_, ok = serial.SetString(v, 0)
+	}
+	if !ok {
+		return nil, fmt.Errorf("serial must be a decimal, 0x-prefixed or colon separated hex number")
+	}
+
+	return serial, nil
+}
+
+// timeFlag is a flag.Value setting an RFC 3339 timestamp.
+type timeFlag struct{ t *time.Time }
+
+func (f timeFlag) String() string {
+	if f.t == nil || f.t.IsZero() {
+		return ""
+	}
+
+	return f.t.Format(time.RFC3339)
+}
+
+func (f timeFlag) Set(v string) error {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return fmt.Errorf("must be an RFC 3339 time, e.g. 2020-01-01T00:00:00Z")
+	}
+	*f.t = t
+
+	return nil
+}
+
+// conflict is a flag that can't be combined with the one being validated,
+// set when it was given.
+type conflict struct {
+	set  bool
+	flag string
+}
+
+// conflictError reports the first of conflicts that is set, as prefix
+// followed by the flag.
+func conflictError(prefix string, conflicts []conflict) error {
+	for _, c := range conflicts {
+		if c.set {
+			return fmt.Errorf("%s %s", prefix, c.flag)
+		}
+	}
+
+	return nil
+}
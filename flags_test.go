@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseSerial(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+	}{
+		{"418", 418},
+		{"0x1a2", 418},
+		{"01:a2", 418},
+		{"0x01:A2", 418},
+		{"10:00", 4096},
+	} {
+		got, err := parseSerial(tc.in)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got.Int64() != tc.want {
+			t.Errorf("%q: got %s, want %d", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "0xzz", "01:zz", "abc"} {
+		if _, err := parseSerial(in); err == nil {
+			t.Errorf("%q was accepted", in)
+		}
+	}
+}
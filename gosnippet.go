@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// goSnippet is a tls.Config for mutual TLS over the generated files. It works
+// for both sides: RootCAs verifies servers, ClientCAs verifies clients.
+const goSnippet = `cert, err := tls.LoadX509KeyPair(%q, %q)
+if err != nil {
+	log.Fatal(err)
+}
+
+caPEM, err := os.ReadFile(%q)
+if err != nil {
+	log.Fatal(err)
+}
+
+pool := x509.NewCertPool()
+if !pool.AppendCertsFromPEM(caPEM) {
+	log.Fatal("no CA certificates found")
+}
+
+cfg := &tls.Config{
+	Certificates: []tls.Certificate{cert},
+	RootCAs:      pool,
+	ClientCAs:    pool,
+	ClientAuth:   tls.RequireAndVerifyClientCert,
+	MinVersion:   tls.VersionTLS12,
+}
+`
+
+// printGoSnippet prints Go code loading the leaf at certPath and keyPath and
+// the CA at caPath into a tls.Config.
+func printGoSnippet(w io.Writer, certPath, keyPath, caPath string) {
+	fmt.Fprintf(w, goSnippet, certPath, keyPath, caPath)
+}
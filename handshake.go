@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const handshakeTimeout = 10 * time.Second
+
+// handshakeTest mints a CA, a server and a client certificate in memory from
+// opts, runs a mutual TLS handshake between them over loopback and prints
+// what was negotiated.
+func handshakeTest(opts *options) error {
+	if len(opts.DNSNames) == 0 && len(opts.IPAddresses) == 0 {
+		opts.DNSNames = []string{"localhost"}
+		opts.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+
+	ca, err := tlsgen.GenerateRootCA(&opts.Options)
+	if err != nil {
+		return err
+	}
+
+	// distinct indexes give the two leaves distinct keys with -seed
+	serverOpts, clientOpts := *opts, *opts
+	serverOpts.Index, clientOpts.Index = 1, 2
+
+	server, err := tlsgen.GenerateLeaf(ca, &serverOpts.Options)
+	if err != nil {
+		return fmt.Errorf("couldn't issue server certificate, %w", err)
+	}
+
+	client, err := tlsgen.GenerateLeaf(ca, &clientOpts.Options)
+	if err != nil {
+		return fmt.Errorf("couldn't issue client certificate, %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.TLSCertificate()},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't listen, %w", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan tls.ConnectionState, 1)
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		_ = tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			serverErr <- err
+			return
+		}
+		accepted <- tlsConn.ConnectionState()
+	}()
+
+	serverName := ""
+	if len(opts.DNSNames) > 0 {
+		serverName = opts.DNSNames[0]
+	} else {
+		serverName = opts.IPAddresses[0].String()
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: handshakeTimeout}, "tcp", ln.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{client.TLSCertificate()},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		// unblocks Accept in case the connection never got that far
+		ln.Close()
+		return fmt.Errorf("client handshake failed, %w", errors.Join(err, <-serverErr))
+	}
+	defer conn.Close()
+
+	var serverState tls.ConnectionState
+	select {
+	case serverState = <-accepted:
+	case err := <-serverErr:
+		return fmt.Errorf("server handshake failed, %w", err)
+	}
+
+	clientState := conn.ConnectionState()
+	fmt.Printf("Version:      %s\n", tls.VersionName(clientState.Version))
+	fmt.Printf("Cipher suite: %s\n", tls.CipherSuiteName(clientState.CipherSuite))
+	fmt.Printf("Server:       %s, verified as %q\n", spiffeIDOf(clientState), serverName)
+	fmt.Printf("Client:       %s\n", spiffeIDOf(serverState))
+
+	return nil
+}
+
+// spiffeIDOf returns the URI SAN of the verified peer certificate in state.
+func spiffeIDOf(state tls.ConnectionState) string {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0][0].URIs) == 0 {
+		return "no SPIFFE ID"
+	}
+
+	return state.VerifiedChains[0][0].URIs[0].String()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	minRSABits      = 2048
+	maxLeafValidity = time.Hour * 24 * 398
+	maxCAValidity   = time.Hour * 24 * 365 * 20
+)
+
+// inspect prints every certificate found in the PEM file at path. When
+// warnWeak is set each certificate is also audited for weak parameters.
+func inspect(path string, warnWeak bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read %q, %w", path, err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %q, %w", path, err)
+	}
+
+	for i, cert := range certs {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		printCertificate(os.Stdout, cert)
+
+		if warnWeak {
+			printFindings(os.Stdout, auditCertificate(cert))
+		}
+	}
+
+	return nil
+}
+
+// parseCertificates decodes all CERTIFICATE blocks in data, skipping others.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return certs, nil
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:  "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:     "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:       "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+func printCertificate(w io.Writer, cert *x509.Certificate) {
+	fmt.Fprintf(w, "Subject:    %s\n", cert.Subject)
+	fmt.Fprintf(w, "Issuer:     %s\n", cert.Issuer)
+	fmt.Fprintf(w, "Serial:     %s\n", colonHex(cert.SerialNumber.Bytes()))
+	fmt.Fprintf(w, "Not Before: %s\n", cert.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "Not After:  %s\n", cert.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "CA:         %t\n", cert.IsCA)
+	printNamesAndUsages(w, cert)
+
+	sum := sha256.Sum256(cert.Raw)
+	fmt.Fprintf(w, "SHA-256:    %s\n", colonHex(sum[:]))
+}
+
+// printNamesAndUsages prints the SANs and key usages of cert, which may
+// also be an unsigned template.
+func printNamesAndUsages(w io.Writer, cert *x509.Certificate) {
+	for _, name := range cert.DNSNames {
+		fmt.Fprintf(w, "DNS:        %s\n", name)
+	}
+	for _, ip := range cert.IPAddresses {
+		fmt.Fprintf(w, "IP:         %s\n", ip)
+	}
+	for _, uri := range cert.URIs {
+		fmt.Fprintf(w, "URI:        %s\n", uri)
+	}
+	for _, email := range cert.EmailAddresses {
+		fmt.Fprintf(w, "Email:      %s\n", email)
+	}
+
+	var usages []string
+	for _, u := range keyUsageNames {
+		if cert.KeyUsage&u.usage != 0 {
+			usages = append(usages, u.name)
+		}
+	}
+	fmt.Fprintf(w, "Key Usage:  %s\n", listOrNone(usages))
+
+	usages = nil
+	for _, u := range cert.ExtKeyUsage {
+		name, ok := extKeyUsageNames[u]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", u)
+		}
+		usages = append(usages, name)
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		usages = append(usages, oid.String())
+	}
+	fmt.Fprintf(w, "Ext Usage:  %s\n", listOrNone(usages))
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+
+	return strings.Join(items, ", ")
+}
+
+func printFindings(w io.Writer, findings []string) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "Findings:   none")
+		return
+	}
+
+	fmt.Fprintln(w, "Findings:")
+	for _, f := range findings {
+		fmt.Fprintf(w, "  - %s\n", f)
+	}
+}
+
+// auditCertificate returns a human readable finding for every weak or
+// non-recommended parameter of cert.
+func auditCertificate(cert *x509.Certificate) []string {
+	var findings []string
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < minRSABits {
+			findings = append(findings, fmt.Sprintf("RSA key is %d bits, less than %d", bits, minRSABits))
+		}
+	case *ecdsa.PublicKey:
+		if bits := key.Curve.Params().BitSize; bits < 256 {
+			findings = append(findings, fmt.Sprintf("ECDSA curve %s is weaker than P-256", key.Curve.Params().Name))
+		}
+	}
+
+	switch cert.SignatureAlgorithm {
+	case x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+		findings = append(findings, fmt.Sprintf("signature algorithm %s uses SHA-1", cert.SignatureAlgorithm))
+	case x509.MD5WithRSA, x509.MD2WithRSA:
+		findings = append(findings, fmt.Sprintf("signature algorithm %s is broken", cert.SignatureAlgorithm))
+	}
+
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	if cert.IsCA {
+		if validity > maxCAValidity {
+			findings = append(findings, fmt.Sprintf("CA validity of %d days exceeds %d days", days(validity), days(maxCAValidity)))
+		}
+
+		return findings
+	}
+
+	if validity > maxLeafValidity {
+		findings = append(findings, fmt.Sprintf("leaf validity of %d days exceeds %d days", days(validity), days(maxLeafValidity)))
+	}
+
+	if len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.URIs)+len(cert.EmailAddresses) == 0 {
+		findings = append(findings, "leaf has no subject alternative names")
+	}
+
+	return findings
+}
+
+func days(d time.Duration) int {
+	return int(d / (time.Hour * 24))
+}
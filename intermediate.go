@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const (
+	intermediateCAFilePath           = "intermediate/intermediate.pem"
+	intermediateCAPrivateKeyFilePath = "intermediate/intermediate.key"
+)
+
+// generateIntermediate issues an intermediate CA signed by the root CA and
+// saves it next to it. Subsequent leaves are signed by the intermediate.
+func generateIntermediate(opts *options) error {
+	root, err := getCA(opts.caKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	ca, err := tlsgen.GenerateIntermediateCA(root, &opts.Options)
+	if err != nil {
+		return err
+	}
+
+	if opts.stdout {
+		keyBlock, err := privateKeyBlock(ca, opts.keyPassword)
+		if err != nil {
+			return err
+		}
+
+		return writeStdout(os.Stdout, ca.Chain, keyBlock)
+	}
+
+	if err := os.MkdirAll(filepath.Join(tlsDir, filepath.Dir(intermediateCAFilePath)), 0700); err != nil {
+		return fmt.Errorf("couldn't create TLS sub-directory %q. Reason: %w", filepath.Dir(intermediateCAFilePath), err)
+	}
+
+	err = saveBundle(
+		ca,
+		opts.keyPassword,
+		filepath.Join(tlsDir, intermediateCAFilePath),
+		filepath.Join(tlsDir, intermediateCAPrivateKeyFilePath),
+	)
+	if err != nil {
+		return err
+	}
+
+	if opts.crossCert != "" {
+		if err := crossSign(opts, ca.Cert, filepath.Join(tlsDir, intermediateCAFilePath)); err != nil {
+			return err
+		}
+	}
+
+	m := certMetric{
+		role:    "intermediate",
+		path:    filepath.Join(tlsDir, intermediateCAFilePath),
+		keyPath: filepath.Join(tlsDir, intermediateCAPrivateKeyFilePath),
+		cert:    ca.Cert,
+	}
+	logFingerprints(opts.logger, []certMetric{m}, opts.fingerprintFormat)
+
+	if opts.json {
+		if err := printSummary(os.Stdout, []certMetric{m}); err != nil {
+			return err
+		}
+	}
+
+	opts.logger.Infof("Certificate material generated in %q\n", tlsDir)
+	return nil
+}
+
+// getIssuer returns the CA leaves are signed by: the intermediate CA when one
+// was generated with -intermediate, the root CA otherwise. The chain of the
+// returned certificate always ends with the root. password decrypts both.
+func getIssuer(password string) (*tlsgen.CertBundle, error) {
+	root, err := getCA(password)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := loadCA(
+		filepath.Join(tlsDir, intermediateCAFilePath),
+		newCASigner(filepath.Join(tlsDir, intermediateCAPrivateKeyFilePath), password),
+	)
+	if errors.Is(err, fs.ErrNotExist) {
+		return root, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("an error occured when attempting to load intermediate certificate data, %w", err)
+	}
+
+	if !ca.Cert.IsCA {
+		return nil, ErrNotCA
+	}
+
+	// e.g. the root was regenerated with -force since
+	if err := ca.Cert.CheckSignatureFrom(root.Cert); err != nil {
+		return nil, fmt.Errorf("intermediate CA in %q wasn't issued by the current root CA, regenerate it with -intermediate, %w", tlsDir, err)
+	}
+
+	ca.Chain = append(ca.Chain[:1], root.Chain[0])
+	return ca, nil
+}
+
+// intermediates returns the certificates in the chain of ca below the root,
+// the ones a leaf signed by ca needs to send along.
+func intermediates(ca *tlsgen.CertBundle) [][]byte {
+	return ca.Chain[:len(ca.Chain)-1]
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// privateKeyBlock returns the PEM block for the private key of b in the
+// -key-format encoding, encrypted when password isn't empty.
+func privateKeyBlock(b *tlsgen.CertBundle, password string) (*pem.Block, error) {
+	block, err := tlsgen.MarshalPrivateKeyAs(b.Key, keyFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return tlsgen.EncryptKeyBlock(block, password)
+}
+
+// loadPrivateKey reads the private key stored in the PEM file at path,
+// decrypting it with password if needed.
+func loadPrivateKey(path, password string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read private key, %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %q", path)
+	}
+
+	block, err = tlsgen.DecryptKeyBlock(block, password)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := tlsgen.ParsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+
+	return key, nil
+}
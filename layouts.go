@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const (
+	dockerSecretID  = "tlsgen-ca"
+	dockerSecretDir = "docker"
+	nginxDir        = "nginx"
+	nginxCertFile   = "fullchain.pem"
+	nginxKeyFile    = "privkey.pem"
+	envoyDir        = "envoy"
+	envoyCertFile   = "cert.pem"
+	envoyKeyFile    = "key.pem"
+	envoyCAFile     = "ca.pem"
+	envoyCertSDS    = "tls_certificate.yaml"
+	envoyCASDS      = "validation_context.yaml"
+	trustedCAFile   = "ca/root-trusted.pem"
+	bundleCertFile  = "tls.crt"
+	bundleKeyFile   = "tls.key"
+	bundleCAFile    = "ca.crt"
+	pfxFriendlyName = "tlsgen-dev"
+)
+
+// envoySecretTemplate is a filesystem SDS resource file. Envoy watches the
+// file and, through watched_directory, the referenced PEM files.
+const envoySecretTemplate = `resources:
+- "@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret"
+  name: %s
+%s`
+
+const envoyCertSecret = `  tls_certificate:
+    certificate_chain:
+      filename: %s
+    private_key:
+      filename: %s
+    watched_directory:
+      path: %s
+`
+
+const envoyCASecret = `  validation_context:
+    trusted_ca:
+      filename: %s
+    watched_directory:
+      path: %s
+`
+
+const envoySnippet = `# transport_socket typed_config, e.g. DownstreamTlsContext.common_tls_context
+tls_certificate_sds_secret_configs:
+- name: tlsgen_cert
+  sds_config:
+    path_config_source:
+      path: %s
+validation_context_sds_secret_config:
+  name: tlsgen_ca
+  sds_config:
+    path_config_source:
+      path: %s
+`
+
+// writeLayouts writes the additional, tool specific output layouts selected
+// in opts. leaf is nil when only a root CA was generated.
+func writeLayouts(opts *options, ca, leaf *tlsgen.CertBundle) error {
+	if opts.dockerSecret {
+		if err := writeDockerSecret(ca); err != nil {
+			return err
+		}
+	}
+
+	if opts.trustedCA {
+		if err := writeTrustedCA(ca); err != nil {
+			return err
+		}
+	}
+
+	if opts.nginx {
+		if leaf == nil {
+			return fmt.Errorf("-nginx requires a leaf certificate and can't be used with -root")
+		}
+		if err := writeNginx(ca, leaf, opts.keyPassword); err != nil {
+			return err
+		}
+	}
+
+	if opts.envoy {
+		if leaf == nil {
+			return fmt.Errorf("-envoy requires a leaf certificate and can't be used with -root")
+		}
+		if err := writeEnvoy(ca, leaf); err != nil {
+			return err
+		}
+	}
+
+	if opts.bundle {
+		if leaf == nil {
+			return fmt.Errorf("-bundle requires a leaf certificate and can't be used with -root")
+		}
+		certPath, _ := leafPaths(opts)
+		if err := writeBundle(filepath.Dir(certPath), ca, leaf, opts.chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// layoutConflicts are the flags writing or printing more than the leaf and
+// its key, which the modes producing a single file can't be combined with.
+func (o *options) layoutConflicts() []conflict {
+	return []conflict{
+		{o.dockerSecret, "-docker-secret"},
+		{o.trustedCA, "-trusted-ca"},
+		{o.nginx, "-nginx"},
+		{o.envoy, "-envoy"},
+		{o.goSnippet, "-go-snippet"},
+		{o.keyWithCA, "-key-with-ca"},
+		{o.pfx, "-pfx"},
+	}
+}
+
+// writeBundle writes the leaf followed by its intermediates, and the root
+// too with chain, its key and the CA to dir, named the way Kubernetes TLS
+// secrets and cert-manager lay them out.
+func writeBundle(dir string, ca, leaf *tlsgen.CertBundle, chain bool) error {
+	// Kubernetes doesn't take encrypted keys, validate refuses -key-password with -bundle
+	keyBlock, err := privateKeyBlock(leaf, "")
+	if err != nil {
+		return err
+	}
+
+	certs := append(leaf.Chain[:1:1], intermediates(ca)...)
+	if chain {
+		certs = append(certs, ca.Root())
+	}
+
+	if err := saveWithPaths(certs, keyBlock, filepath.Join(dir, bundleCertFile), filepath.Join(dir, bundleKeyFile)); err != nil {
+		return err
+	}
+
+	bundle, err := trustBundle(ca)
+	if err != nil {
+		return err
+	}
+
+	return writePEM(filepath.Join(dir, bundleCAFile), 0644, bundle...)
+}
+
+// writeDockerSecret writes the CA certificate as a single file, ready to be
+// passed to `docker build --secret` and mounted with RUN --mount=type=secret.
+func writeDockerSecret(ca *tlsgen.CertBundle) error {
+	path := filepath.Join(tlsDir, dockerSecretDir, dockerSecretID)
+	bundle, err := trustBundle(ca)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(path, 0644, bundle...); err != nil {
+		return err
+	}
+
+	fmt.Printf("# build with the dev CA available as a secret\n")
+	fmt.Printf("docker build --secret id=%s,src=%s .\n\n", dockerSecretID, path)
+	fmt.Printf("# then use it in a Dockerfile step, it is only mounted for the duration of that step\n")
+	fmt.Printf("RUN --mount=type=secret,id=%s curl --cacert /run/secrets/%s https://my-service.local/\n", dockerSecretID, dockerSecretID)
+
+	return nil
+}
+
+// certAux is OpenSSL's X509_CERT_AUX, the trust settings that follow the
+// certificate in a TRUSTED CERTIFICATE block.
+type certAux struct {
+	Trust []asn1.ObjectIdentifier
+	Alias string `asn1:"utf8,optional"`
+}
+
+// writeTrustedCA writes the root CA as an OpenSSL TRUSTED CERTIFICATE, marked
+// as trusted for TLS server and client authentication.
+func writeTrustedCA(ca *tlsgen.CertBundle) error {
+	root := ca.Root()
+	cert, err := x509.ParseCertificate(root)
+	if err != nil {
+		return fmt.Errorf("root ca certificate contains errors, %w", err)
+	}
+
+	aux, err := asn1.Marshal(certAux{
+		Trust: []asn1.ObjectIdentifier{
+			{1, 3, 6, 1, 5, 5, 7, 3, 1}, // serverAuth
+			{1, 3, 6, 1, 5, 5, 7, 3, 2}, // clientAuth
+		},
+		Alias: cert.Subject.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't encode trust settings, %w", err)
+	}
+
+	block := &pem.Block{Type: "TRUSTED CERTIFICATE", Bytes: append(append([]byte{}, root...), aux...)}
+	return writePEM(filepath.Join(tlsDir, trustedCAFile), 0644, block)
+}
+
+// writeNginx writes the leaf followed by its intermediates, without the root,
+// and the leaf key, using the file names nginx setups conventionally use,
+// then prints the config lines.
+func writeNginx(ca, leaf *tlsgen.CertBundle, password string) error {
+	certPath := filepath.Join(tlsDir, nginxDir, nginxCertFile)
+	keyPath := filepath.Join(tlsDir, nginxDir, nginxKeyFile)
+
+	blocks := []*pem.Block{{Type: "CERTIFICATE", Bytes: leaf.Chain[0]}}
+	for _, der := range intermediates(ca) {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	if err := writePEM(certPath, 0644, blocks...); err != nil {
+		return err
+	}
+
+	keyBlock, err := privateKeyBlock(leaf, password)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(keyPath, 0600, keyBlock); err != nil {
+		return err
+	}
+
+	fmt.Printf("ssl_certificate     %s;\n", certPath)
+	fmt.Printf("ssl_certificate_key %s;\n", keyPath)
+	if password != "" {
+		fmt.Printf("ssl_password_file   /path/to/file/holding/the/-key-password;\n")
+	}
+
+	return nil
+}
+
+// writeEnvoy writes the leaf, its key and the CA together with filesystem SDS
+// resource files referencing them, then prints the matching Envoy config.
+func writeEnvoy(ca, leaf *tlsgen.CertBundle) error {
+	dir := filepath.Join(tlsDir, envoyDir)
+	certPath := filepath.Join(dir, envoyCertFile)
+	keyPath := filepath.Join(dir, envoyKeyFile)
+	caPath := filepath.Join(dir, envoyCAFile)
+	certSDS := filepath.Join(dir, envoyCertSDS)
+	caSDS := filepath.Join(dir, envoyCASDS)
+
+	// Envoy doesn't get the password, validate refuses -key-password with -envoy
+	keyBlock, err := privateKeyBlock(leaf, "")
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(keyPath, 0600, keyBlock); err != nil {
+		return err
+	}
+
+	chain := []*pem.Block{{Type: "CERTIFICATE", Bytes: leaf.Chain[0]}}
+	for _, der := range intermediates(ca) {
+		chain = append(chain, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	if err := writePEM(certPath, 0644, chain...); err != nil {
+		return err
+	}
+
+	bundle, err := trustBundle(ca)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(caPath, 0644, bundle...); err != nil {
+		return err
+	}
+
+	certSecret := fmt.Sprintf(envoySecretTemplate, "tlsgen_cert", fmt.Sprintf(envoyCertSecret, certPath, keyPath, dir))
+	if err := writeFile(certSDS, 0644, []byte(certSecret)); err != nil {
+		return err
+	}
+
+	caSecret := fmt.Sprintf(envoySecretTemplate, "tlsgen_ca", fmt.Sprintf(envoyCASecret, caPath, dir))
+	if err := writeFile(caSDS, 0644, []byte(caSecret)); err != nil {
+		return err
+	}
+
+	fmt.Printf(envoySnippet, certSDS, caSDS)
+
+	return nil
+}
+
+// trustBundle returns the certificates of the ca chain for clients to trust,
+// intermediates first and the self-signed root last, the order verifiers
+// expect when building a path from a bundle.
+func trustBundle(ca *tlsgen.CertBundle) ([]*pem.Block, error) {
+	var intermediates, roots []*pem.Block
+	for _, der := range ca.Chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("ca chain contains errors, %w", err)
+		}
+
+		block := &pem.Block{Type: "CERTIFICATE", Bytes: der}
+		if isSelfSigned(cert) {
+			roots = append(roots, block)
+		} else {
+			intermediates = append(intermediates, block)
+		}
+	}
+
+	return append(intermediates, roots...), nil
+}
+
+// writePEM writes blocks to path, see writeFile.
+func writePEM(path string, perm os.FileMode, blocks ...*pem.Block) error {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		if err := pem.Encode(&buf, b); err != nil {
+			return fmt.Errorf("couldn't encode %s pem: %w", b.Type, err)
+		}
+	}
+
+	return writeFile(path, perm, buf.Bytes())
+}
+
+// writeFile atomically replaces path with data, creating the parent directory
+// if needed. Replacing by rename lets file watchers (e.g. Envoy) pick up a
+// complete file. When perm grants nothing to group and others, that is
+// verified before any data is written.
+func writeFile(path string, perm os.FileMode, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("couldn't create directory for %q, %w", path, err)
+	}
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("couldn't create file %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := f.Chmod(perm); err != nil {
+		return fmt.Errorf("couldn't set mode of %q, %w", path, err)
+	}
+
+	// private files hold key material, make sure they really are private
+	if perm&0077 == 0 {
+		if err := verifyKeyPermissions(f.Name()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("couldn't write %q, %w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("couldn't write %q, %w", path, err)
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// writePFX writes leaf, its key and the whole ca chain as a PKCS#12 archive
+// next to certPath, for Windows and Java consumers that want a single file.
+func writePFX(certPath string, leaf, ca *tlsgen.CertBundle, password string) error {
+	certs := append(leaf.Chain[:1:1], ca.Chain...)
+	data, err := tlsgen.EncodePKCS12(leaf.Key, certs, password, pfxFriendlyName)
+	if err != nil {
+		return fmt.Errorf("couldn't build PKCS#12 archive, %w", err)
+	}
+
+	return writeFile(strings.TrimSuffix(certPath, filepath.Ext(certPath))+".p12", 0600, data)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const ledgerFile = "issued.json"
+
+// ledgerEntry records a single issued leaf certificate.
+type ledgerEntry struct {
+	Serial    string    `json:"serial"`
+	Subject   string    `json:"subject"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	IssuedAt  time.Time `json:"issued_at"`
+}
+
+// recordIssued appends cert to the ledger in tlsDir. The read-modify-write is
+// done under an exclusive lock, so concurrent processes (e.g. parallel CI
+// jobs) can't lose or corrupt each other's entries.
+func recordIssued(cert *x509.Certificate) error {
+	path := filepath.Join(tlsDir, ledgerFile)
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("couldn't lock the ledger, %w", err)
+	}
+	defer unlock()
+
+	var entries []ledgerEntry
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("couldn't read the ledger, %w", err)
+	default:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("ledger %q is corrupt, %w", path, err)
+		}
+	}
+
+	entries = append(entries, ledgerEntry{
+		Serial:    fmt.Sprintf("%x", cert.SerialNumber),
+		Subject:   cert.Subject.String(),
+		SANs:      subjectAltNames(cert),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+		IssuedAt:  time.Now().UTC(),
+	})
+
+	data, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// replaced atomically, readers that don't lock never see a partial file
+	return writeFile(path, 0644, append(data, '\n'))
+}
+
+// subjectAltNames returns every SAN of cert in a printable form.
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+
+	return sans
+}
@@ -0,0 +1,39 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	lockRetryInterval = 50 * time.Millisecond
+	lockTimeout       = 30 * time.Second
+)
+
+// lockFile takes an exclusive lock by creating path, waiting for another
+// holder to remove it. Unlike flock it isn't released when a process dies.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %q, remove it if no other process is running", path)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io"
+	"log"
+)
+
+// logger writes progress messages, which -quiet silences, as well as
+// warnings and errors, which are always written.
+type logger struct {
+	*log.Logger
+	// quiet drops Infof messages, see -quiet
+	quiet bool
+}
+
+// newLogger returns a logger writing timestamped lines to w.
+func newLogger(w io.Writer) *logger {
+	return &logger{Logger: log.New(w, "", log.LstdFlags)}
+}
+
+// Infof logs an informational message, unless quiet is set.
+func (l *logger) Infof(format string, v ...any) {
+	if l.quiet {
+		return
+	}
+
+	l.Printf(format, v...)
+}
+
+// Warnf logs a warning, quiet or not.
+func (l *logger) Warnf(format string, v ...any) {
+	l.Printf("WARNING: "+format, v...)
+}
@@ -1,95 +1,498 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io/fs"
 	"math/big"
-	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
 )
 
 const (
-	tlsDir                        = "/tmp/tls"
-	certificateOrganization       = "My Dev org"
-	certificateNotAfter           = time.Hour * 4
-	certificateFilePath           = "client/client.pem"
-	certificatePrivateKeyFilePath = "client/client-key.pem"
-	rootCAFilePath                = "ca/root.pem"
-	rootCAPrivateKeyFilePath      = "ca/root.key"
-	rootCANotAfter                = time.Hour * 24 * 365 * 10 // 10 years
-	spiffeDomain                  = "local.dev"
+	defaultTLSDir                 = tlsgen.DefaultDir
+	certificateFilePath           = tlsgen.LeafCertFile
+	certificatePrivateKeyFilePath = tlsgen.LeafKeyFile
+	rootCAFilePath                = tlsgen.RootCertFile
+	rootCAPrivateKeyFilePath      = tlsgen.RootKeyFile
+	// pairLockFile in the -out directory serializes writing certificate and
+	// key pairs
+	pairLockFile     = ".tlsgen.lock"
+	caKeyPasswordEnv = "TLSGEN_CA_KEY_PASSWORD"
+	keyPasswordEnv   = "TLSGEN_KEY_PASSWORD"
+	// sourceDateEpochEnv is the reproducible builds timestamp, in Unix seconds
+	sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
 )
 
 var (
-	tlsSubPaths      = []string{"ca", "client", "client"}
-	spiffeWorkloadID = getWorkloadID()
+	// tlsDir is where all material is read from and written to, see -out
+	tlsDir      = defaultTLSDir
+	tlsSubPaths = []string{"ca", "client"}
+	// caCertFile and caKeyFile override the root CA location, see -ca-cert
+	caCertFile, caKeyFile string
+	// keyFormat is the encoding of written RSA private keys, see -key-format
+	keyFormat = tlsgen.KeyFormatPKCS1
 )
 
+// rootCertPath returns where the root CA certificate is read from and written to.
+func rootCertPath() string {
+	if caCertFile != "" {
+		return caCertFile
+	}
+
+	return filepath.Join(tlsDir, rootCAFilePath)
+}
+
+// rootKeyPath returns where the root CA private key is read from and written to.
+func rootKeyPath() string {
+	if caKeyFile != "" {
+		return caKeyFile
+	}
+
+	return filepath.Join(tlsDir, rootCAPrivateKeyFilePath)
+}
+
+// options holds the user supplied settings for a single invocation. The
+// embedded tlsgen.Options shape the certificates, the rest where and how
+// they are written.
+type options struct {
+	tlsgen.Options
+
+	caKeyPassword string
+	keyPassword   string
+	force         bool
+	overwrite     bool
+	dockerSecret  bool
+	nginx         bool
+	envoy         bool
+	bundle        bool
+	chain         bool
+	stdout        bool
+	json          bool
+	pfx           bool
+	pfxPassword   string
+	ledger        bool
+	keyWithCA     bool
+	count         int
+	names         []string
+	// workload is the -name of the leaf within a named bulk run
+	workload     string
+	textfileOut  string
+	strict       bool
+	trustedCA    bool
+	certOnly     bool
+	certDir      string
+	keyDir       string
+	goSnippet    bool
+	csr          bool
+	csrSigAlg    x509.SignatureAlgorithm
+	signCSR      string
+	renew        string
+	crl          bool
+	revoked      []*big.Int
+	revokeFile   string
+	ocspResponse string
+	selfSigned   bool
+	dryRun       bool
+	reuseKey     bool
+	nameTpl      string
+	keyNameTpl   string
+	timestampDir bool
+	keep         int
+	// crossCert and crossKey are the second CA of -ca-cert2 and -ca-key2
+	crossCert, crossKey string
+	// fingerprintFormat is fingerprintHex or fingerprintBase64
+	fingerprintFormat string
+	// generation is the timestamped leaf directory relative to tlsDir
+	generation string
+	// logger receives progress messages, warnings and errors, see -quiet
+	logger *logger
+}
+
+// newOptions returns options with every setting at its default value.
+func newOptions() options {
+	return options{
+		Options:           tlsgen.DefaultOptions(),
+		count:             1,
+		fingerprintFormat: fingerprintHex,
+		logger:            newLogger(os.Stderr),
+	}
+}
+
+// validate rejects option combinations that would produce a broken certificate.
+func (o *options) validate() error {
+	if err := o.Options.Validate(); err != nil {
+		return err
+	}
+
+	if o.keep < 0 {
+		return fmt.Errorf("-keep must not be negative")
+	}
+
+	if !slices.Contains(tlsgen.KeyFormats, keyFormat) {
+		return fmt.Errorf("unknown -key-format %q, must be %s or %s", keyFormat, tlsgen.KeyFormatPKCS1, tlsgen.KeyFormatPKCS8)
+	}
+
+	switch o.fingerprintFormat {
+	case fingerprintHex, fingerprintBase64:
+	default:
+		return fmt.Errorf("unknown -fingerprint-format %q, must be %s or %s", o.fingerprintFormat, fingerprintHex, fingerprintBase64)
+	}
+
+	if o.pfxPassword != "" && !o.pfx {
+		return fmt.Errorf("-pfx-password requires -pfx")
+	}
+
+	if o.pfx && o.certOnly {
+		return fmt.Errorf("-pfx needs the new leaf key and can't be combined with -cert-only")
+	}
+
+	if o.json && (o.nginx || o.envoy || o.dockerSecret || o.goSnippet) {
+		return fmt.Errorf("-json can't be combined with -nginx, -envoy, -docker-secret or -go-snippet, which print to stdout too")
+	}
+
+	if (caCertFile == "") != (caKeyFile == "") {
+		return fmt.Errorf("-ca-cert and -ca-key must be set together")
+	}
+
+	if o.keep > 0 && !o.timestampDir {
+		return fmt.Errorf("-keep requires -timestamp-dir")
+	}
+
+	if err := validateNameTemplate("name-template", o.nameTpl, o.count > 1); err != nil {
+		return err
+	}
+
+	if err := validateNameTemplate("key-name-template", o.keyNameTemplate(), o.count > 1); err != nil {
+		return err
+	}
+
+	if o.nameTpl != "" && expandName(o.nameTpl, o) == expandName(o.keyNameTemplate(), o) {
+		return fmt.Errorf("-name-template and -key-name-template must produce different file names")
+	}
+
+	if o.certOnly && o.keyWithCA {
+		return fmt.Errorf("-cert-only doesn't write the key file, drop -key-with-ca")
+	}
+
+	if (o.certDir != "" || o.keyDir != "") && o.timestampDir {
+		return fmt.Errorf("-cert-dir and -key-dir can't be combined with -timestamp-dir")
+	}
+
+	if o.certOnly && o.timestampDir {
+		return fmt.Errorf("-cert-only can't be combined with -timestamp-dir, every generation starts without a key")
+	}
+
+	if o.keyPassword != "" && o.envoy {
+		return fmt.Errorf("-envoy can't read keys encrypted with -key-password")
+	}
+
+	if o.keyPassword != "" && o.bundle {
+		return fmt.Errorf("-bundle writes a Kubernetes TLS secret layout, which can't hold keys encrypted with -key-password")
+	}
+
+	if o.bundle {
+		conflicts := []conflict{
+			{o.stdout, "-stdout"},
+			{o.csr, "-csr"},
+			{o.signCSR != "", "-sign-csr"},
+			{o.selfSigned, "-self-signed"},
+		}
+		if err := conflictError("-bundle can't be combined with", conflicts); err != nil {
+			return err
+		}
+	}
+
+	if o.csrSigAlg != x509.UnknownSignatureAlgorithm && !o.csr {
+		return fmt.Errorf("-csr-sig-alg requires -csr")
+	}
+
+	if o.csr {
+		conflicts := []conflict{
+			{o.count > 1, "-count"},
+			{o.certOnly, "-cert-only"},
+			{o.timestampDir, "-timestamp-dir"},
+			{o.ledger, "-ledger"},
+			{o.nginx, "-nginx"},
+			{o.envoy, "-envoy"},
+			{o.chain, "-chain"},
+		}
+		if err := conflictError("-csr only writes a key and request and can't be combined with", conflicts); err != nil {
+			return err
+		}
+	}
+
+	if o.count < 1 {
+		return fmt.Errorf("-count must be at least 1")
+	}
+
+	if o.count > 1 && (o.nginx || o.envoy) {
+		return fmt.Errorf("-nginx and -envoy write fixed file names and can't be used with -count")
+	}
+
+	if o.count > 1 && o.goSnippet {
+		return fmt.Errorf("-go-snippet can't be used with -count")
+	}
+
+	if o.Serial != nil && (o.count > 1 || len(o.names) > 0) {
+		return fmt.Errorf("-serial sets a single serial number and can't be used with -count or -name")
+	}
+
+	if err := o.validateNames(); err != nil {
+		return err
+	}
+
+	if err := o.validateStdout(); err != nil {
+		return err
+	}
+
+	if err := o.validateSignCSR(); err != nil {
+		return err
+	}
+
+	if err := o.validateRenew(); err != nil {
+		return err
+	}
+
+	if err := o.validateCRL(); err != nil {
+		return err
+	}
+
+	if err := o.validateSelfSigned(); err != nil {
+		return err
+	}
+
+	if err := o.validateDryRun(); err != nil {
+		return err
+	}
+
+	if err := o.validateCrossSign(); err != nil {
+		return err
+	}
+
+	if err := validateOCSPStatus("ocsp-response", o.ocspResponse); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func main() {
-	root := flag.Bool("root", false, "Should we generate a root CA instead?")
+	if len(os.Args) > 1 {
+		var cmd func([]string) error
+		switch os.Args[1] {
+		case "serve":
+			cmd = serve
+		case "probe":
+			cmd = probe
+		}
+
+		if cmd != nil {
+			if err := cmd(os.Args[2:]); err != nil {
+				newLogger(os.Stderr).Warnf("%s\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	opts := newOptions()
+	m := &modes{}
+	m.registerFlags(flag.CommandLine, &opts)
 	flag.Parse()
 
-	var err error
-	if *root {
-		err = generateRoot()
-	} else {
-		err = run()
+	if m.config != "" {
+		if err := applyConfig(flag.CommandLine, m.config); err != nil {
+			opts.logger.Fatalln(err)
+		}
 	}
 
-	if err != nil {
-		log.Fatalln(err)
+	if err := opts.readEnv(); err != nil {
+		opts.logger.Fatalln(err)
 	}
 
-	log.Printf("Certificate material generated in %q\n", tlsDir)
+	if query := m.query(&opts); query != nil {
+		if err := query(); err != nil {
+			opts.logger.Fatalln(err)
+		}
+		return
+	}
+
+	if opts.Seed != nil {
+		opts.logger.Warnf("-seed makes keys reproducible by anyone who knows the seed, never use it for production material")
+	}
+
+	if err := opts.validate(); err != nil {
+		opts.logger.Fatalln(err)
+	}
+
+	if err := m.validate(&opts); err != nil {
+		opts.logger.Fatalln(err)
+	}
+
+	if err := m.generate(&opts); err != nil {
+		opts.logger.Fatalln(err)
+	}
 }
 
-func run() error {
-	// read root certificate/key pair
-	ca, err := getCA()
+// readEnv fills in the settings that can come from the environment instead
+// of a flag.
+func (o *options) readEnv() error {
+	if o.caKeyPassword == "" {
+		o.caKeyPassword = os.Getenv(caKeyPasswordEnv)
+	}
+	if o.keyPassword == "" {
+		o.keyPassword = os.Getenv(keyPasswordEnv)
+	}
+	// a CA written with -key-password is read back with the same password
+	if o.caKeyPassword == "" {
+		o.caKeyPassword = o.keyPassword
+	}
+
+	if v := os.Getenv(sourceDateEpochEnv); v != "" {
+		epoch, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("$%s must be a Unix timestamp in seconds, got %q", sourceDateEpochEnv, v)
+		}
+		o.StartTime = time.Unix(epoch, 0).UTC()
+	}
+
+	return nil
+}
+
+func run(opts *options) error {
+	if err := opts.loadRenewal(); err != nil {
+		return err
+	}
+
+	// read the issuing certificate/key pair
+	ca, err := getIssuer(opts.caKeyPassword)
 	if err != nil {
 		return err
 	}
 
+	if opts.stdout {
+		return generateCertKey(ca, opts)
+	}
+
 	// setup cert dir
-	if err := createCertDir(); err != nil {
+	if err := createCertDir(opts.logger); err != nil {
 		return err
 	}
 
+	if err := createLeafDirs(opts); err != nil {
+		return err
+	}
+
+	if opts.timestampDir {
+		generation, err := newGeneration(time.Now())
+		if err != nil {
+			return err
+		}
+		opts.generation = generation
+	}
+
 	// generate tls material
-	return generateCertKey(&ca)
+	if err := generateCertKey(ca, opts); err != nil {
+		return err
+	}
+
+	if opts.timestampDir {
+		if err := activateGeneration(opts.generation); err != nil {
+			return err
+		}
+
+		if opts.keep > 0 {
+			if err := pruneGenerations(opts.logger, opts.keep); err != nil {
+				return err
+			}
+		}
+	}
+
+	opts.logger.Infof("Certificate material generated in %q\n", tlsDir)
+	return nil
 }
 
-func getCA() (tls.Certificate, error) {
-	tlsData, err := tls.LoadX509KeyPair(
-		fmt.Sprintf("%s/%s", tlsDir, rootCAFilePath),
-		fmt.Sprintf("%s/%s", tlsDir, rootCAPrivateKeyFilePath),
-	)
+func getCA(password string) (*tlsgen.CertBundle, error) {
+	ca, err := loadCA(rootCertPath(), newCASigner(rootKeyPath(), password))
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("an error occured when attempting to load root certificate data, %w", err)
+		return nil, fmt.Errorf("an error occured when attempting to load root certificate data, %w", err)
+	}
+
+	if !ca.Cert.IsCA {
+		return nil, ErrNotCA
 	}
 
-	cert, err := x509.ParseCertificate(tlsData.Certificate[0])
+	return ca, nil
+}
+
+// loadKeyPair works like tls.LoadX509KeyPair, but also accepts a private key
+// encrypted with password.
+func loadKeyPair(certPath, keyPath, password string) (*tlsgen.CertBundle, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %q", keyPath)
+	}
+
+	block, err = tlsgen.DecryptKeyBlock(block, password)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(block))
+	if err != nil {
+		if mismatchedKeyPair(certPEM, block) {
+			return nil, fmt.Errorf("%q and %q: %w", certPath, keyPath, ErrKeyMismatch)
+		}
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T in %q", pair.PrivateKey, keyPath)
+	}
+
+	return tlsgen.NewCertBundle(pair.Certificate, key)
+}
+
+// mismatchedKeyPair reports whether both halves parse fine on their own, but
+// the key doesn't belong to the certificate.
+func mismatchedKeyPair(certPEM []byte, keyBlock *pem.Block) bool {
+	certs, err := parseCertificates(certPEM)
 	if err != nil {
-		return tls.Certificate{}, err
+		return false
 	}
 
-	if !cert.IsCA {
-		return tls.Certificate{}, fmt.Errorf("this is not a root certificate")
+	key, err := tlsgen.ParsePrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return false
 	}
 
-	return tlsData, nil
+	return !tlsgen.KeyMatches(key, certs[0].PublicKey)
 }
 
-func createCertDir() error {
+func createCertDir(l *logger) error {
 	// Create TLS directory
 	if err := os.MkdirAll(tlsDir, 0700); err != nil {
 		return fmt.Errorf("couldn't create TLS directory %q. Reason: %w", tlsDir, err)
@@ -102,164 +505,431 @@ func createCertDir() error {
 		}
 	}
 
-	log.Println("Created TLS directories")
+	l.Infof("Created TLS directories")
 	return nil
 }
 
-func generateRoot() error {
+// createLeafDirs creates the -cert-dir and -key-dir trees. Only the key
+// directory is restricted to the owner.
+func createLeafDirs(opts *options) error {
+	if opts.certDir != "" {
+		if err := os.MkdirAll(opts.certDir, 0755); err != nil {
+			return fmt.Errorf("couldn't create certificate directory %q. Reason: %w", opts.certDir, err)
+		}
+	}
+
+	if opts.keyDir != "" {
+		if err := os.MkdirAll(opts.keyDir, 0700); err != nil {
+			return fmt.Errorf("couldn't create key directory %q. Reason: %w", opts.keyDir, err)
+		}
+	}
+
+	return nil
+}
+
+func generateRoot(opts *options) error {
+	if opts.stdout {
+		ca, err := tlsgen.GenerateRootCA(&opts.Options)
+		if err != nil {
+			return err
+		}
+
+		keyBlock, err := privateKeyBlock(ca, opts.keyPassword)
+		if err != nil {
+			return err
+		}
+
+		return writeStdout(os.Stdout, ca.Chain, keyBlock)
+	}
+
+	if !opts.force {
+		ca, err := reusableRoot(opts)
+		if err != nil {
+			return err
+		}
+		if ca != nil {
+			return writeRootOutputs(opts, ca)
+		}
+	}
+
+	if err := checkRootOverwrite(opts); err != nil {
+		return err
+	}
+
 	// setup cert dir
-	if err := createCertDir(); err != nil {
+	if err := createCertDir(opts.logger); err != nil {
 		return err
 	}
 
-	// create private key
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ca, err := tlsgen.GenerateRootCA(&opts.Options)
 	if err != nil {
-		return fmt.Errorf("couldn't generate a private key, %w", err)
+		return err
 	}
 
-	keyBytes := x509.MarshalPKCS1PrivateKey(key)
+	if err := saveRoot(ca, opts.keyPassword); err != nil {
+		return err
+	}
 
-	// create certificate template
-	tpl, err := newCertTemplate(true)
-	if err != nil {
-		return fmt.Errorf("failed generating certificate template, %w", err)
+	if err := writeRootOutputs(opts, ca); err != nil {
+		return err
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
-	if err != nil {
-		return fmt.Errorf("couldn't generate new certificate %w", err)
+	opts.logger.Infof("Certificate material generated in %q\n", tlsDir)
+	return nil
+}
+
+// writeRootOutputs writes the optional extra outputs of a root CA run.
+func writeRootOutputs(opts *options, ca *tlsgen.CertBundle) error {
+	if err := writeLayouts(opts, ca, nil); err != nil {
+		return err
 	}
 
-	// validate certificate is correct
-	_, err = x509.ParseCertificate(derBytes)
-	if err != nil {
-		return fmt.Errorf("generated certificate contains errors, %w", err)
+	metrics := []certMetric{{role: "root", path: rootCertPath(), keyPath: rootKeyPath(), cert: ca.Cert}}
+	logFingerprints(opts.logger, metrics, opts.fingerprintFormat)
+
+	if opts.json {
+		if err := printSummary(os.Stdout, metrics); err != nil {
+			return err
+		}
 	}
 
-	return saveRoot(derBytes, keyBytes)
+	if opts.textfileOut == "" {
+		return nil
+	}
+
+	return writeTextfile(opts.textfileOut, metrics)
 }
 
-func generateCertKey(ca *tls.Certificate) error {
-	// create private key
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+// reusableRoot returns the existing root CA if it's still valid and can be
+// kept instead of generating a new one. A missing root, or with -overwrite one
+// that can't sign now, e.g. expired or not yet valid, yields nil. One that
+// can't be loaded is an error so it isn't silently destroyed.
+func reusableRoot(opts *options) (*tlsgen.CertBundle, error) {
+	ca, err := getCA(opts.caKeyPassword)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("couldn't generate a private key, %w", err)
+		return nil, fmt.Errorf("%w (use -force to replace it)", err)
+	}
+
+	cert := ca.Cert
+	if err := tlsgen.CheckCAValidity(cert, time.Now()); err != nil {
+		if !opts.overwrite {
+			return nil, fmt.Errorf("existing root %w, pass -overwrite to replace it", err)
+		}
+		opts.logger.Infof("Existing root %s, generating a new one\n", err)
+		return nil, nil
+	}
+
+	opts.logger.Infof("Reusing existing root CA %q, valid until %s (use -force to regenerate)\n", rootCertPath(), cert.NotAfter.UTC().Format(time.RFC3339))
+	return ca, nil
+}
+
+// checkRootOverwrite refuses to replace an existing root CA file unless
+// -overwrite or -force allow it, since every leaf signed by it stops
+// verifying. This also covers a root that couldn't be reused because one of
+// its files is missing.
+func checkRootOverwrite(opts *options) error {
+	if opts.overwrite || opts.force {
+		return nil
 	}
 
-	keyBytes := x509.MarshalPKCS1PrivateKey(key)
+	for _, path := range []string{rootCertPath(), rootKeyPath()} {
+		_, err := os.Stat(path)
+		if err == nil {
+			return fmt.Errorf("%q already exists, pass -overwrite to replace the root CA and invalidate every certificate it signed", path)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("couldn't check for an existing root CA, %w", err)
+		}
+	}
 
-	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	return nil
+}
+
+func generateCertKey(ca *tlsgen.CertBundle, opts *options) error {
+	if opts.keyWithCA {
+		opts.logger.Warnf("-key-with-ca appends the CA certificate to the private key file, a non-standard layout most tools won't accept")
+	}
+
+	rootCert, err := x509.ParseCertificate(ca.Root())
 	if err != nil {
 		return fmt.Errorf("root ca certificate contains errors, %w", err)
 	}
 
-	// create certificate template
-	tpl, err := newCertTemplate(false)
+	tpl, err := tlsgen.LeafTemplate(&opts.Options)
 	if err != nil {
-		return fmt.Errorf("failed generating certificate template, %w", err)
+		return err
+	}
+	if err := checkServerAuthValidity(tpl); err != nil {
+		if opts.strict {
+			return err
+		}
+		opts.logger.Warnf("%s\n", err)
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, tpl, caCert, &key.PublicKey, ca.PrivateKey)
-	if err != nil {
-		return fmt.Errorf("couldn't generate new certificate %w", err)
+	metrics := []certMetric{{role: "root", path: rootCertPath(), cert: rootCert}}
+	if len(ca.Chain) > 1 {
+		metrics = append(metrics, certMetric{role: "intermediate", path: filepath.Join(tlsDir, intermediateCAFilePath), cert: ca.Cert})
 	}
 
-	// validate certificate is correct
-	_, err = x509.ParseCertificate(derBytes)
-	if err != nil {
-		return fmt.Errorf("generated certificate contains errors, %w", err)
+	var errs []error
+	if opts.count <= 1 && len(opts.names) == 0 {
+		m, err := generateLeaf(ca, opts)
+		if err != nil {
+			return err
+		}
+		metrics = append(metrics, m)
+	} else {
+		// bulk mode, keep going on failures so they can all be fixed at once
+		leaves := bulkLeaves(opts)
+		for _, leafOpts := range leaves {
+			m, err := generateLeaf(ca, &leafOpts)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("certificate %s: %w", leafOpts.bulkLabel(), err))
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+
+		opts.logger.Infof("Generated %d of %d certificates\n", len(leaves)-len(errs), len(leaves))
 	}
 
-	return save(derBytes, keyBytes)
+	logFingerprints(opts.logger, metrics, opts.fingerprintFormat)
+
+	if opts.textfileOut != "" {
+		if err := writeTextfile(opts.textfileOut, metrics); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if opts.json {
+		// only what this run wrote, the CA chain was there before
+		leaves := slices.DeleteFunc(metrics, func(m certMetric) bool { return m.role != "leaf" })
+		if err := printSummary(os.Stdout, leaves); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func newCertTemplate(root bool) (*x509.Certificate, error) {
-	// random serial number
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+// checkServerAuthValidity reports serverAuth leaves that browsers reject for
+// being valid longer than maxLeafValidity.
+func checkServerAuthValidity(tpl *x509.Certificate) error {
+	if !slices.Contains(tpl.ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		return nil
+	}
+
+	if tpl.NotAfter.After(tpl.NotBefore.Add(maxLeafValidity)) {
+		// time.Duration saturates at ~292 years, which -no-expiry exceeds
+		validity := (tpl.NotAfter.Unix() - tpl.NotBefore.Unix()) / 86400
+		return fmt.Errorf("serverAuth leaf validity of %d days exceeds the %d days browsers accept", validity, days(maxLeafValidity))
+	}
+
+	return nil
+}
+
+// generateLeaf issues and saves a single leaf certificate.
+func generateLeaf(ca *tlsgen.CertBundle, opts *options) (certMetric, error) {
+	certPath, keyPath := leafPaths(opts)
+	if opts.certOnly {
+		key, err := loadPrivateKey(keyPath, opts.keyPassword)
+		if err != nil {
+			return certMetric{}, fmt.Errorf("-cert-only needs the existing key, %w", err)
+		}
+
+		leafOpts := *opts
+		leafOpts.LeafKey = key
+		opts = &leafOpts
+	}
+
+	leaf, err := tlsgen.GenerateLeaf(ca, &opts.Options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate serial number %w", err)
+		return certMetric{}, err
 	}
 
-	startTime := time.Now()
+	var keyExtra []*pem.Block
+	if opts.keyWithCA {
+		keyExtra = append(keyExtra, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Chain[0]})
+	}
 
-	tpl := x509.Certificate{
-		SerialNumber:          serialNumber,
-		Subject:               pkix.Name{Organization: []string{certificateOrganization}},
-		SignatureAlgorithm:    x509.SHA256WithRSA,
-		NotBefore:             startTime,
-		NotAfter:              startTime.Add(certificateNotAfter),
-		BasicConstraintsValid: true,
+	var keyBlock *pem.Block
+	if !opts.certOnly {
+		keyBlock, err = privateKeyBlock(leaf, opts.keyPassword)
+		if err != nil {
+			return certMetric{}, err
+		}
 	}
 
-	if root {
-		tpl.Subject = pkix.Name{Organization: []string{certificateOrganization + " ROOT CA"}}
-		tpl.IsCA = true
-		tpl.NotAfter = startTime.Add(rootCANotAfter)
+	// intermediates are needed by clients to build a path to the root
+	certs := append(leaf.Chain[:1:1], intermediates(ca)...)
+	if opts.chain {
+		certs = append(certs, ca.Root())
+	}
+	if opts.stdout {
+		return certMetric{role: "leaf", cert: leaf.Cert}, writeStdout(os.Stdout, certs, keyBlock)
+	}
 
-		return &tpl, nil
+	if opts.workload != "" {
+		for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return certMetric{}, fmt.Errorf("couldn't create workload directory %q. Reason: %w", dir, err)
+			}
+		}
 	}
 
-	tpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
-	tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if err := saveWithPaths(certs, keyBlock, certPath, keyPath, keyExtra...); err != nil {
+		return certMetric{}, err
+	}
 
-	// add SPIFFE specifics which we must not have in the root
-	spiffeID := fmt.Sprintf("spiffe://%s/%s", spiffeDomain, spiffeWorkloadID)
-	uri, err := url.Parse(spiffeID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid spiffe id, %w", err)
+	if opts.crossCert != "" {
+		if err := crossSign(opts, leaf.Cert, certPath); err != nil {
+			return certMetric{}, err
+		}
 	}
 
-	tpl.URIs = []*url.URL{uri}
+	if opts.pfx {
+		if err := writePFX(certPath, leaf, ca, opts.pfxPassword); err != nil {
+			return certMetric{}, err
+		}
+	}
 
-	return &tpl, nil
-}
+	if opts.ledger {
+		if err := recordIssued(leaf.Cert); err != nil {
+			return certMetric{}, err
+		}
+	}
+
+	if err := writeLayouts(opts, ca, leaf); err != nil {
+		return certMetric{}, err
+	}
+
+	if opts.goSnippet {
+		printGoSnippet(os.Stdout, certPath, keyPath, rootCertPath())
+	}
+
+	m := certMetric{role: "leaf", path: certPath, cert: leaf.Cert}
+	if !opts.certOnly {
+		m.keyPath = keyPath
+	}
 
-func getWorkloadID() string {
-	hn, _ := os.Hostname()
-	return strings.ToLower(strings.Split(hn, ".")[0])
+	return m, nil
 }
 
-func save(cert, key []byte) error {
-	return saveWithPaths(
-		cert,
-		key,
-		fmt.Sprintf("%s/%s", tlsDir, certificateFilePath),
-		fmt.Sprintf("%s/%s", tlsDir, certificatePrivateKeyFilePath),
-	)
+// leafPaths returns where the leaf with the bulk index in opts is written.
+// Index 0 is a regular, single leaf. Name templates replace the default
+// file names, -cert-dir and -key-dir the default directory. Leaves of a
+// -name run go to a subdirectory named after their workload instead of
+// being numbered.
+func leafPaths(opts *options) (string, string) {
+	dir := clientDir()
+	if opts.generation != "" {
+		dir = opts.generation
+	}
+
+	certDir, keyDir := filepath.Join(tlsDir, dir), filepath.Join(tlsDir, dir)
+	if opts.certDir != "" {
+		certDir = opts.certDir
+	}
+	if opts.keyDir != "" {
+		keyDir = opts.keyDir
+	}
+	if opts.workload != "" {
+		certDir, keyDir = filepath.Join(certDir, opts.workload), filepath.Join(keyDir, opts.workload)
+	}
+
+	if opts.nameTpl != "" || opts.keyNameTpl != "" {
+		certName, keyName := filepath.Base(certificateFilePath), filepath.Base(certificatePrivateKeyFilePath)
+		if opts.nameTpl != "" {
+			certName = expandName(opts.nameTpl, opts)
+		}
+		if tpl := opts.keyNameTemplate(); tpl != "" {
+			keyName = expandName(tpl, opts)
+		}
+
+		return filepath.Join(certDir, certName), filepath.Join(keyDir, keyName)
+	}
+
+	certPath := filepath.Join(certDir, filepath.Base(certificateFilePath))
+	keyPath := filepath.Join(keyDir, filepath.Base(certificatePrivateKeyFilePath))
+	if opts.Index == 0 || opts.workload != "" {
+		return certPath, keyPath
+	}
+
+	return fmt.Sprintf("%s-%d.pem", strings.TrimSuffix(certPath, ".pem"), opts.Index),
+		fmt.Sprintf("%s-%d-key.pem", strings.TrimSuffix(keyPath, "-key.pem"), opts.Index)
 }
 
-func saveRoot(cert, key []byte) error {
-	return saveWithPaths(
-		cert,
-		key,
-		fmt.Sprintf("%s/%s", tlsDir, rootCAFilePath),
-		fmt.Sprintf("%s/%s", tlsDir, rootCAPrivateKeyFilePath),
-	)
+func saveRoot(ca *tlsgen.CertBundle, password string) error {
+	// -ca-cert and -ca-key may point outside of the created TLS directories
+	for _, path := range []string{rootCertPath(), rootKeyPath()} {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("couldn't create CA directory %q. Reason: %w", filepath.Dir(path), err)
+		}
+	}
+
+	return saveBundle(ca, password, rootCertPath(), rootKeyPath())
 }
 
-func saveWithPaths(cert, key []byte, certPath, keyPath string) error {
-	// Key
-	privKey, err := os.OpenFile(keyPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0700)
+// saveBundle writes the certificate of b and its key, encrypted with
+// password when set, to certPath and keyPath.
+func saveBundle(b *tlsgen.CertBundle, password, certPath, keyPath string) error {
+	keyBlock, err := privateKeyBlock(b, password)
 	if err != nil {
-		return fmt.Errorf("couldn't create private key file %w", err)
+		return err
 	}
 
-	err = pem.Encode(privKey, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: key})
+	return saveWithPaths(b.Chain[:1], keyBlock, certPath, keyPath)
+}
+
+// saveWithPaths writes the certificate and key PEM files. The certificate
+// file holds certs in the given order. keyExtra blocks are appended to the
+// key file after the private key. A nil key leaves the key file untouched and
+// only writes the certificate. Both files are replaced atomically under a lock
+// in the -out directory, so concurrent runs writing the same leaf can't pair
+// one's certificate with another's key.
+func saveWithPaths(certs [][]byte, key *pem.Block, certPath, keyPath string, keyExtra ...*pem.Block) error {
+	lockPath := filepath.Join(tlsDir, pairLockFile)
+	unlock, err := lockFile(lockPath)
 	if err != nil {
-		return fmt.Errorf("couldn't encode private pem: %w", err)
+		return fmt.Errorf("couldn't lock %q, %w", lockPath, err)
 	}
+	defer unlock()
 
-	// Certificate
-	certFile, err := os.OpenFile(certPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return fmt.Errorf("couldn't create certificate file %w", err)
+	if key != nil {
+		if err := saveKey(key, keyPath, keyExtra...); err != nil {
+			return err
+		}
+	}
+
+	blocks := make([]*pem.Block, 0, len(certs))
+	for _, cert := range certs {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: cert})
 	}
 
-	err = pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	return writePEM(certPath, 0644, blocks...)
+}
+
+// saveKey writes the private key block, followed by keyExtra, to keyPath.
+// writeFile checks that the file is private before key material lands in it.
+func saveKey(key *pem.Block, keyPath string, keyExtra ...*pem.Block) error {
+	return writePEM(keyPath, 0600, append([]*pem.Block{key}, keyExtra...)...)
+}
+
+// verifyKeyPermissions makes sure the private key at path isn't accessible by
+// group or others. The umask can only remove permission bits, so any such bit
+// means the filesystem (e.g. some FUSE or 9p mounts) ignored the requested
+// mode.
+func verifyKeyPermissions(path string) error {
+	fi, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("couldn't encode certificate pem: %w", err)
+		return fmt.Errorf("couldn't stat private key file %w", err)
+	}
+
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("private key file %q has mode %#o and is readable by others, the filesystem didn't apply restrictive permissions", path, perm)
 	}
 
 	return nil
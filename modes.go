@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// modes holds the flags selecting what an invocation does that aren't part
+// of the options, along with the settings only the query modes read.
+type modes struct {
+	root, intermediate, handshake bool
+	// config is the -config file, applied after parsing the command line
+	config string
+
+	inspect       string
+	warnWeak      bool
+	caFingerprint bool
+	status        bool
+	verify        bool
+	verifyUsage   string
+	verifyDNS     string
+	validateOnly  bool
+	validateCert  string
+	validateKey   string
+	validateCA    string
+	caOnlyVerify  bool
+}
+
+// registerFlags registers every flag of the main command on fs, storing the
+// values in m and opts.
+func (m *modes) registerFlags(fs *flag.FlagSet, opts *options) {
+	m.registerModeFlags(fs, opts)
+	m.registerQueryFlags(fs)
+	registerCAFlags(fs, opts)
+	registerLeafFlags(fs, opts)
+	registerValidityFlags(fs, opts)
+	registerKeyFlags(fs, opts)
+	registerRevocationFlags(fs, opts)
+	registerOutputFlags(fs, opts)
+}
+
+// registerModeFlags registers the flags selecting what to issue, other than
+// a leaf from the CA in the -out directory.
+func (m *modes) registerModeFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&m.root, "root", false, "Should we generate a root CA instead?")
+	fs.BoolVar(&m.intermediate, "intermediate", false, "Generate an intermediate CA signed by the root CA, which then signs all leaves")
+	fs.BoolVar(&opts.selfSigned, "self-signed", false, "Generate a self-signed leaf certificate, without reading or creating a CA")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Print the certificate template the other flags describe and exit without generating keys or writing files")
+	fs.BoolVar(&m.handshake, "handshake-test", false, "Mint a CA, server and client certificate in memory and run a mutual TLS handshake with them")
+	fs.BoolVar(&opts.csr, "csr", false, "Write a leaf key and certificate signing request for an external CA instead of a certificate")
+	fs.StringVar(&opts.signCSR, "sign-csr", "", "Issue a leaf certificate for the subject, SANs and key of this PEM certificate signing request")
+	fs.StringVar(&opts.renew, "renew", "", "Reissue this PEM leaf certificate with its subject and SANs, signed by the current CA with a fresh validity")
+	fs.BoolVar(&opts.crl, "crl", false, "Write a CRL signed by the issuing CA, revoking the -revoke and -revoke-file serials, to "+rootCRLFilePath)
+	fs.StringVar(&opts.ocspResponse, "ocsp-response", "", "Write an OCSP response with this status for the existing leaf next to it (client/client.ocsp): "+strings.Join(tlsgen.OCSPStatuses, ", "))
+	fs.StringVar(&m.config, "config", "", "JSON or YAML file with flag values, keyed by flag name, flags on the command line take precedence")
+}
+
+// registerQueryFlags registers the modes that read existing material instead
+// of issuing any, and their settings.
+func (m *modes) registerQueryFlags(fs *flag.FlagSet) {
+	fs.StringVar(&m.inspect, "inspect", "", "Print details of the certificates in the given PEM file instead of generating")
+	fs.BoolVar(&m.warnWeak, "warn-weak", false, "With -inspect, flag weak or non-recommended certificate parameters")
+	fs.BoolVar(&m.caFingerprint, "ca-fingerprint", false, "Print the fingerprints of the root CA in the -out directory for certificate and public key pinning")
+	fs.BoolVar(&m.status, "status", false, "Print the remaining validity of the CA and leaf in the -out directory and fail if either expired")
+	fs.BoolVar(&m.verify, "verify", false, "Verify the existing leaf against the root CA and print the chain instead of generating")
+	fs.StringVar(&m.verifyUsage, "verify-usage", "any", "With -verify, extended key usage the leaf must be valid for: any, server or client")
+	fs.StringVar(&m.verifyDNS, "verify-dns", "", "With -verify, DNS name the leaf must be valid for")
+	fs.BoolVar(&m.validateOnly, "validate-only", false, "Check an existing cert and key pair instead of generating")
+	fs.StringVar(&m.validateCert, "validate-cert", "", "With -validate-only, certificate to check (default <out>/"+certificateFilePath+")")
+	fs.StringVar(&m.validateKey, "validate-key", "", "With -validate-only, private key that must match the certificate (default <out>/"+certificatePrivateKeyFilePath+")")
+	fs.StringVar(&m.validateCA, "validate-ca", "", "With -validate-only, CA certificate(s) the certificate must chain to (default <out>/"+rootCAFilePath+")")
+	fs.BoolVar(&m.caOnlyVerify, "ca-only-verify", true, "With -verify and -validate-only, reject self-signed certificates; set to false to allow them")
+}
+
+// registerCAFlags registers the settings of -root and of the CA that signs.
+func registerCAFlags(fs *flag.FlagSet, opts *options) {
+	fs.DurationVar(&opts.CATTL, "ca-ttl", opts.CATTL, "With -root, validity of the root CA, e.g. 87600h")
+	fs.Func("ca-ski", "With -root, hex Subject Key Identifier to pin instead of deriving it from the key", func(v string) error {
+		ski, err := hex.DecodeString(strings.ReplaceAll(v, ":", ""))
+		if err != nil || len(ski) == 0 {
+			return fmt.Errorf("subject key identifier must be a non-empty hex string")
+		}
+		opts.CASKI = ski
+		return nil
+	})
+	fs.Var((*stringSlice)(&opts.PermittedDNSDomains), "permitted-dns", "With -root, DNS domain the CA may issue for, a name constraint (repeatable)")
+	fs.Var((*stringSlice)(&opts.ExcludedDNSDomains), "excluded-dns", "With -root, DNS domain the CA must not issue for, a name constraint (repeatable)")
+	fs.Var((*stringSlice)(&opts.PermittedURIDomains), "permitted-uri", "With -root, URI host domain, e.g. the SPIFFE trust domain, the CA may issue for (repeatable)")
+	fs.BoolVar(&opts.force, "force", false, "With -root, always generate a new root CA even if a valid one exists (implies -overwrite)")
+	fs.BoolVar(&opts.overwrite, "overwrite", false, "With -root, allow replacing an existing, e.g. expired, root CA, which invalidates every certificate it signed")
+	fs.StringVar(&caCertFile, "ca-cert", "", "Root CA certificate to use instead of the one in the -out directory (requires -ca-key)")
+	fs.StringVar(&caKeyFile, "ca-key", "", "Root CA private key to use instead of the one in the -out directory (requires -ca-cert)")
+	fs.StringVar(&opts.caKeyPassword, "ca-key-password", "", "Password of an encrypted root CA private key (or set $"+caKeyPasswordEnv+")")
+	fs.StringVar(&opts.crossCert, "ca-cert2", "", "Second CA certificate to cross-sign the leaf or -intermediate with, written to <name>-cross.pem (requires -ca-key2)")
+	fs.StringVar(&opts.crossKey, "ca-key2", "", "Private key of the -ca-cert2 CA, decrypted with -ca-key-password (requires -ca-cert2)")
+}
+
+// registerLeafFlags registers the settings shaping leaf certificates.
+func registerLeafFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.CommonName, "cn", "", "Subject common name of the leaf certificate")
+	fs.StringVar(&opts.Organization, "org", opts.Organization, "Subject organization, the root CA gets a \" ROOT CA\" suffix")
+	fs.BoolVar(&opts.CNFromSPIFFE, "cn-from-spiffe", false, "Set the leaf common name to the full SPIFFE ID")
+	fs.BoolVar(&opts.AllowLongCN, "allow-long-cn", false, "Allow common names longer than 64 characters (for negative testing only)")
+	fs.Func("subject-der", "Hex DER encoded subject to use verbatim on the leaf certificate", func(v string) error {
+		der, err := hex.DecodeString(strings.ReplaceAll(v, ":", ""))
+		if err != nil {
+			return fmt.Errorf("subject must be a hex string")
+		}
+		var rdns pkix.RDNSequence
+		rest, err := asn1.Unmarshal(der, &rdns)
+		if err != nil || len(rest) > 0 {
+			return fmt.Errorf("subject isn't a DER encoded distinguished name")
+		}
+		opts.SubjectDER = der
+		return nil
+	})
+	fs.StringVar(&opts.DBUser, "db-user", "", "With -profile database, database user to put in the leaf common name")
+	fs.StringVar(&opts.DeviceID, "device-id", "", "With -profile iot-device, device identifier to put in the leaf common name")
+	fs.Var((*stringSlice)(&opts.DNSNames), "dns", "DNS name to add as SAN to the leaf certificate (repeatable)")
+	fs.Func("ip", "IP address to add as SAN to the leaf certificate (repeatable)", func(v string) error {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return fmt.Errorf("%q isn't a valid IP address", v)
+		}
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+		return nil
+	})
+	fs.Var((*stringSlice)(&opts.IPCIDRs), "ip-cidr", "CIDR range whose every address is added as IP SAN to the leaf certificate, at most 256 addresses (repeatable)")
+	fs.Var((*stringSlice)(&opts.Emails), "email", "Email address to add as SAN to the leaf certificate (repeatable)")
+	fs.Var((*stringSlice)(&opts.URIs), "uri", "Absolute URI to add as SAN to the leaf certificate, next to the SPIFFE ID (repeatable)")
+	fs.BoolVar(&opts.AllowInvalidSAN, "allow-invalid-san", false, "Skip SAN syntax validation (for negative testing only)")
+	fs.BoolVar(&opts.SPIFFE, "spiffe", opts.SPIFFE, "Add the SPIFFE ID as URI SAN to the leaf certificate")
+	fs.StringVar(&opts.SPIFFEDomain, "spiffe-domain", opts.SPIFFEDomain, "Trust domain of the leaf SPIFFE ID")
+	fs.StringVar(&opts.SPIFFEID, "spiffe-id", "", "Workload path of the leaf SPIFFE ID (default the hostname)")
+	fs.StringVar(&opts.K8sNamespace, "k8s-namespace", "", "Kubernetes namespace encoded in the SPIFFE ID (requires -k8s-sa)")
+	fs.StringVar(&opts.K8sSA, "k8s-sa", "", "Kubernetes service account encoded in the SPIFFE ID (requires -k8s-namespace)")
+	fs.Var((*stringSlice)(&opts.names), "name", "Workload to issue a leaf for, used as SPIFFE ID path and written to client/<name>/ (repeatable)")
+	fs.IntVar(&opts.count, "count", opts.count, "Number of leaf certificates to generate, more than one are written as client-N.pem")
+	fs.StringVar(&opts.Profile, "profile", "", "Shape the leaf certificate for a use case: "+strings.Join(tlsgen.ProfileNames(), ", "))
+	fs.StringVar(&opts.Usage, "usage", opts.Usage, "Extended key usage of the leaf certificate: server, client or both")
+	fs.BoolVar(&opts.MustStaple, "must-staple", false, "Add the TLS Feature extension requiring OCSP stapling (status_request) to the leaf certificate")
+	fs.Func("aki", "Hex Authority Key Identifier for the leaf to reference instead of the signing CA's SKI", func(v string) error {
+		aki, err := hex.DecodeString(strings.ReplaceAll(v, ":", ""))
+		if err != nil || len(aki) == 0 {
+			return fmt.Errorf("authority key identifier must be a non-empty hex string")
+		}
+		opts.AKI = aki
+		return nil
+	})
+	fs.StringVar(&opts.AKIMode, "aki-mode", opts.AKIMode, "Authority Key Identifier form on leaf certificates: keyid or issuer-serial")
+	fs.Func("serial", "Fixed serial number, decimal or 0x-prefixed hex, instead of a random one", func(v string) error {
+		serial, err := parseSerial(v)
+		if err != nil {
+			return err
+		}
+		opts.Serial = serial
+		return nil
+	})
+	fs.IntVar(&opts.SerialBits, "serial-bits", opts.SerialBits, fmt.Sprintf("Bit length of random serial numbers, between %d and %d", tlsgen.MinSerialBits, tlsgen.MaxSerialBits))
+	fs.BoolVar(&opts.strict, "strict", false, "Fail instead of warning when a serverAuth leaf is valid longer than browsers accept")
+	fs.BoolVar(&opts.FIPS, "fips", false, "Only allow FIPS approved key types and signature algorithms")
+}
+
+// registerValidityFlags registers the settings of the validity window.
+func registerValidityFlags(fs *flag.FlagSet, opts *options) {
+	fs.DurationVar(&opts.LeafTTL, "leaf-ttl", opts.LeafTTL, "Validity of leaf certificates, e.g. 720h")
+	fs.Var(timeFlag{&opts.NotBefore}, "not-before", "RFC 3339 time validity starts at instead of now, the TTL counts from it, e.g. 2020-01-01T00:00:00Z")
+	fs.Var(timeFlag{&opts.NotAfter}, "not-after", "RFC 3339 time validity ends at instead of after the TTL, e.g. 2020-01-02T00:00:00Z")
+	fs.DurationVar(&opts.Backdate, "backdate", opts.Backdate, "Move NotBefore back by this much to tolerate clock skew, without shortening the validity")
+	fs.DurationVar(&opts.ValidityJitter, "validity-jitter", 0, "Shift each leaf's expiry by a random offset of up to ± this duration")
+	fs.BoolVar(&opts.AlignUTCDay, "align-utc-day", false, "Start validity at 00:00:00Z and end it at 23:59:59Z of the respective UTC days")
+	fs.BoolVar(&opts.NoExpiry, "no-expiry", false, "Set NotAfter to the RFC 5280 no-expiry value 99991231235959Z")
+}
+
+// registerKeyFlags registers the settings of generated and reused keys.
+func registerKeyFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.KeyType, "key-type", opts.KeyType, "Private key type: "+strings.Join(tlsgen.KeyTypes, ", "))
+	fs.IntVar(&opts.RSABits, "rsa-bits", opts.RSABits, "RSA key size with -key-type rsa: 2048, 3072 or 4096")
+	fs.StringVar(&keyFormat, "key-format", keyFormat, "Encoding of RSA private keys: pkcs1 (RSA PRIVATE KEY) or pkcs8 (PRIVATE KEY)")
+	fs.StringVar(&opts.keyPassword, "key-password", "", "Encrypt written private keys as PKCS#8 with this password (or set $"+keyPasswordEnv+")")
+	fs.Func("seed", "Hex seed making keys and serials reproducible. INSECURE, for test fixtures only", func(v string) error {
+		seed, err := hex.DecodeString(v)
+		if err != nil || len(seed) == 0 {
+			return fmt.Errorf("seed must be a non-empty hex string")
+		}
+		opts.Seed = seed
+		return nil
+	})
+	fs.Func("csr-sig-alg", "With -csr, signature algorithm of the request, e.g. SHA384-RSA or ECDSA-SHA384 (default follows the key)", func(v string) error {
+		alg, err := parseCSRSignatureAlgorithm(v)
+		if err != nil {
+			return err
+		}
+		opts.csrSigAlg = alg
+		return nil
+	})
+	fs.BoolVar(&opts.certOnly, "cert-only", false, "Re-issue the leaf certificate for its existing private key and leave the key file untouched")
+	fs.BoolVar(&opts.reuseKey, "reuse-key", false, "With -renew, keep the private key of the renewed leaf, read from next to it (<name>-key.pem)")
+}
+
+// registerRevocationFlags registers the settings of -crl, -ocsp-response
+// and of the revocation URLs put into leaves.
+func registerRevocationFlags(fs *flag.FlagSet, opts *options) {
+	fs.Func("revoke", "With -crl, serial number of a certificate to revoke, decimal or 0x-prefixed hex (repeatable)", func(v string) error {
+		serial, err := parseSerial(v)
+		if err != nil {
+			return err
+		}
+		opts.revoked = append(opts.revoked, serial)
+		return nil
+	})
+	fs.StringVar(&opts.revokeFile, "revoke-file", "", "With -crl, file with one serial number to revoke per line")
+	fs.DurationVar(&opts.CRLTTL, "crl-ttl", opts.CRLTTL, "With -crl or -ocsp-response, time until the next update of the CRL or OCSP response")
+	fs.Var((*stringSlice)(&opts.CRLURLs), "crl-url", "CRL distribution point URL to add to leaf certificates (repeatable)")
+	fs.Var((*stringSlice)(&opts.OCSPURLs), "ocsp-url", "OCSP responder URL to add to leaf certificates (repeatable)")
+}
+
+// registerOutputFlags registers where and in which layouts material is
+// written, and what gets printed.
+func registerOutputFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&tlsDir, "out", tlsDir, "Directory to read the CA from and write all generated material to")
+	fs.StringVar(&opts.certDir, "cert-dir", "", "Directory to write leaf certificates to instead of <out>/"+clientDir())
+	fs.StringVar(&opts.keyDir, "key-dir", "", "Directory to write leaf private keys to instead of <out>/"+clientDir())
+	fs.StringVar(&opts.nameTpl, "name-template", "", "Leaf certificate file name, {index} and {host} are replaced, e.g. \"{host}.crt\"")
+	fs.StringVar(&opts.keyNameTpl, "key-name-template", "", "Leaf key file name, {index} and {host} are replaced, defaults to the -name-template name with a -key.pem suffix")
+	fs.BoolVar(&opts.timestampDir, "timestamp-dir", false, "Write leaves to a new timestamped directory under client/ and point client/current at it")
+	fs.IntVar(&opts.keep, "keep", 0, "With -timestamp-dir, keep only the newest N timestamped directories (0 keeps all)")
+	fs.BoolVar(&opts.chain, "chain", false, "Append the CA chain up to and including the root to the leaf certificate file")
+	fs.BoolVar(&opts.keyWithCA, "key-with-ca", false, "Append the CA certificate to the leaf private key file (non-standard, for appliances that need it)")
+	fs.BoolVar(&opts.ledger, "ledger", false, "Record every issued leaf certificate in "+ledgerFile)
+	fs.StringVar(&opts.textfileOut, "textfile-out", "", "Write certificate expiry metrics to this node_exporter textfile collector file (*.prom)")
+	fs.BoolVar(&opts.nginx, "nginx", false, "Also write fullchain.pem and privkey.pem for nginx and print the config lines")
+	fs.BoolVar(&opts.envoy, "envoy", false, "Also write cert, key, CA and filesystem SDS files for Envoy and print the config snippet")
+	fs.BoolVar(&opts.bundle, "bundle", false, "Also write the leaf with its chain, its key and the CA as tls.crt, tls.key and ca.crt next to the leaf, as in Kubernetes TLS secrets")
+	fs.BoolVar(&opts.pfx, "pfx", false, "Also write the leaf, its key and the CA chain as a PKCS#12 archive next to the leaf certificate (client/client.p12)")
+	fs.StringVar(&opts.pfxPassword, "pfx-password", "", "With -pfx, password protecting the archive (default empty)")
+	fs.BoolVar(&opts.dockerSecret, "docker-secret", false, "Also write the root CA as a BuildKit secret file and print how to mount it")
+	fs.BoolVar(&opts.trustedCA, "trusted-ca", false, "Also write the root CA as an OpenSSL TRUSTED CERTIFICATE to "+trustedCAFile)
+	fs.BoolVar(&opts.goSnippet, "go-snippet", false, "Print Go code loading the generated leaf and CA into a tls.Config")
+	fs.BoolVar(&opts.stdout, "stdout", false, "Write the certificate(s) followed by the private key as PEM to stdout instead of files")
+	fs.BoolVar(&opts.json, "json", false, "Print a JSON object describing every generated certificate to stdout")
+	fs.BoolVar(&opts.logger.quiet, "quiet", false, "Only log warnings and errors, not progress messages such as the fingerprints and where material was written")
+	fs.StringVar(&opts.fingerprintFormat, "fingerprint-format", opts.fingerprintFormat, "Encoding of the SHA-256 fingerprints logged for generated certificates: hex or base64")
+}
+
+// query returns the selected mode that reads existing material instead of
+// issuing any, nil if none is.
+func (m *modes) query(opts *options) func() error {
+	switch {
+	case m.inspect != "":
+		return func() error { return inspect(m.inspect, m.warnWeak) }
+	case m.caFingerprint:
+		return func() error { return printCAFingerprints(os.Stdout, rootCertPath()) }
+	case m.status:
+		return func() error { return status(opts) }
+	case m.verify:
+		return func() error { return verifyLeaf(os.Stdout, opts, m.verifyUsage, m.verifyDNS, !m.caOnlyVerify) }
+	case m.validateOnly:
+		return m.validatePair(opts)
+	}
+
+	return nil
+}
+
+// validatePair returns the -validate-only check, of the pair in the -out
+// directory unless -validate-cert and -validate-key name another one.
+func (m *modes) validatePair(opts *options) func() error {
+	paths := tlsgen.DefaultPaths(tlsDir)
+	if m.validateCert == "" {
+		m.validateCert = paths.LeafCert
+	}
+	if m.validateKey == "" {
+		m.validateKey = paths.LeafKey
+	}
+	if m.validateCA == "" {
+		m.validateCA = rootCertPath()
+	}
+
+	if opts.count > 1 {
+		return func() error { return validateBulk(opts, m.validateCA, !m.caOnlyVerify) }
+	}
+
+	return func() error {
+		return validatePair(m.validateCert, m.validateKey, m.validateCA, opts.keyPassword, !m.caOnlyVerify)
+	}
+}
+
+// validate rejects combinations of modes that issue different material.
+func (m *modes) validate(opts *options) error {
+	if m.root && m.intermediate {
+		return fmt.Errorf("-root and -intermediate can't be combined, generate the root first")
+	}
+
+	if (opts.crl || opts.ocspResponse != "") && (m.root || m.intermediate) {
+		return fmt.Errorf("-crl and -ocsp-response can't be combined with -root or -intermediate, generate the CA first")
+	}
+
+	if opts.selfSigned && (m.root || m.intermediate) {
+		return fmt.Errorf("-self-signed can't be combined with -root or -intermediate")
+	}
+
+	if opts.crl && opts.ocspResponse != "" {
+		return fmt.Errorf("-crl and -ocsp-response can't be combined, run them one after the other")
+	}
+
+	if opts.crossCert != "" && m.root {
+		return fmt.Errorf("-ca-cert2 cross-signs a leaf or -intermediate and can't be combined with -root")
+	}
+
+	if opts.dryRun && m.handshake {
+		return fmt.Errorf("-dry-run can't be combined with -handshake-test")
+	}
+
+	return nil
+}
+
+// generate runs the selected mode that issues material, by default a leaf
+// signed by the CA in the -out directory.
+func (m *modes) generate(opts *options) error {
+	switch {
+	case opts.dryRun:
+		return dryRun(os.Stdout, opts, m.root, m.intermediate)
+	case m.root:
+		return generateRoot(opts)
+	case m.intermediate:
+		return generateIntermediate(opts)
+	case m.handshake:
+		return handshakeTest(opts)
+	case opts.csr:
+		return generateCSR(opts)
+	case opts.signCSR != "":
+		return signCSR(opts)
+	case opts.selfSigned:
+		return generateSelfSigned(opts)
+	case opts.crl:
+		return generateCRL(opts)
+	case opts.ocspResponse != "":
+		return writeOCSPResponse(opts)
+	default:
+		return run(opts)
+	}
+}
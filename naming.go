@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const (
+	namePlaceholderIndex = "{index}"
+	namePlaceholderHost  = "{host}"
+)
+
+// validateNameTemplate checks a -name-template or -key-name-template value.
+func validateNameTemplate(flagName, tpl string, bulk bool) error {
+	if tpl == "" {
+		return nil
+	}
+
+	if strings.ContainsAny(tpl, `/\`) || filepath.Clean(tpl) != tpl || tpl == ".." {
+		return fmt.Errorf("-%s must be a plain file name", flagName)
+	}
+
+	if bulk && !strings.Contains(tpl, namePlaceholderIndex) {
+		return fmt.Errorf("-%s must contain %s with -count, or every leaf overwrites the previous one", flagName, namePlaceholderIndex)
+	}
+
+	return nil
+}
+
+// keyNameTemplate returns the template for the key file name, derived from
+// the certificate one unless set explicitly.
+func (o *options) keyNameTemplate() string {
+	if o.keyNameTpl != "" || o.nameTpl == "" {
+		return o.keyNameTpl
+	}
+
+	return strings.TrimSuffix(o.nameTpl, filepath.Ext(o.nameTpl)) + "-key.pem"
+}
+
+// expandName fills in the placeholders of a file name template. {index} is
+// the 1-based position within a bulk run, {host} the first DNS name, falling
+// back to the common name and then to "client".
+func expandName(tpl string, opts *options) string {
+	host := "client"
+	switch {
+	case len(opts.DNSNames) > 0:
+		host = opts.DNSNames[0]
+	case opts.CommonName != "":
+		host = opts.CommonName
+	}
+
+	return strings.NewReplacer(
+		namePlaceholderIndex, strconv.Itoa(max(opts.Index, 1)),
+		namePlaceholderHost, host,
+	).Replace(tpl)
+}
+
+// bulkLeaves returns the options of every leaf of a -count or -name run.
+// Each gets its own index, and with it its own seeded key and serial.
+func bulkLeaves(opts *options) []options {
+	var leaves []options
+	for i := 1; i <= max(opts.count, len(opts.names)); i++ {
+		leafOpts := *opts
+		leafOpts.Index = i
+		if len(opts.names) > 0 {
+			leafOpts.workload = opts.names[i-1]
+			leafOpts.SPIFFEID = leafOpts.workload
+		}
+		leaves = append(leaves, leafOpts)
+	}
+
+	return leaves
+}
+
+// bulkLabel identifies the leaf within a bulk run in error messages.
+func (o *options) bulkLabel() string {
+	if o.workload != "" {
+		return strconv.Quote(o.workload)
+	}
+
+	return strconv.Itoa(o.Index)
+}
+
+// validateNames checks the -name workloads, which become both SPIFFE ID
+// paths and directories below client/.
+func (o *options) validateNames() error {
+	if len(o.names) == 0 {
+		return nil
+	}
+
+	conflicts := []conflict{
+		{o.count > 1, "-count"},
+		{o.SPIFFEID != "", "-spiffe-id"},
+		{o.K8sNamespace != "", "-k8s-namespace and -k8s-sa"},
+		{o.nginx, "-nginx"},
+		{o.envoy, "-envoy"},
+		{o.goSnippet, "-go-snippet"},
+		{o.csr, "-csr"},
+		{o.signCSR != "", "-sign-csr"},
+		{o.stdout, "-stdout"},
+	}
+	if err := conflictError("-name can't be combined with", conflicts); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(o.names))
+	for _, name := range o.names {
+		if seen[name] {
+			return fmt.Errorf("-name %q is given more than once", name)
+		}
+		seen[name] = true
+
+		for _, segment := range strings.Split(name, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return fmt.Errorf("-name %q must be a relative path without empty, \".\" or \"..\" segments", name)
+			}
+		}
+
+		// becomes the SPIFFE ID path, see bulkLeaves
+		if o.SPIFFE || o.CNFromSPIFFE {
+			if err := tlsgen.ValidateSPIFFEPath(name); err != nil {
+				return fmt.Errorf("-name: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
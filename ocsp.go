@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// writeOCSPResponse writes a DER OCSP response with the status in
+// opts.ocspResponse for the existing leaf, signed by its issuer, next to the
+// leaf with an .ocsp extension, e.g. for a test server to staple.
+func writeOCSPResponse(opts *options) error {
+	if opts.timestampDir {
+		opts.generation = filepath.Join(clientDir(), currentLink)
+	}
+	certPath, _ := leafPaths(opts)
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read %q, %w", certPath, err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %q, %w", certPath, err)
+	}
+
+	ca, err := getIssuer(opts.caKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	der, err := tlsgen.CreateOCSPResponse(ca, certs[0], opts.ocspResponse, &opts.Options)
+	if err != nil {
+		return err
+	}
+
+	path := strings.TrimSuffix(certPath, filepath.Ext(certPath)) + ".ocsp"
+	if err := writeFile(path, 0644, der); err != nil {
+		return err
+	}
+
+	opts.logger.Infof("OCSP response %q for %s written to %q\n", opts.ocspResponse, certs[0].Subject, path)
+	return nil
+}
+
+// validateOCSPStatus checks an -ocsp-response or -ocsp-staple status.
+func validateOCSPStatus(flagName, status string) error {
+	if status != "" && !slices.Contains(tlsgen.OCSPStatuses, status) {
+		return fmt.Errorf("unknown -%s %q, must be one of: %s", flagName, status, strings.Join(tlsgen.OCSPStatuses, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const probeTimeout = 10 * time.Second
+
+// probe implements the `probe host:port` subcommand: it connects to the
+// target, prints the chain it presents and verifies it against the local CA.
+func probe(args []string) error {
+	fs := flag.NewFlagSet("probe", flag.ContinueOnError)
+	fs.StringVar(&tlsDir, "out", tlsDir, "Directory holding the generated CA and client certificate")
+	mtls := fs.Bool("mtls", false, "Present the generated leaf certificate as client certificate")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s probe [flags] host:port\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("probe needs exactly one host:port argument")
+	}
+
+	addr := fs.Arg(0)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q, %w", addr, err)
+	}
+
+	paths := tlsgen.DefaultPaths(tlsDir)
+	roots, err := tlsgen.CACertPool(paths)
+	if err != nil {
+		return err
+	}
+
+	cfg := &tls.Config{
+		ServerName: host,
+		// the chain is verified below, so it can be printed even when it's broken
+		InsecureSkipVerify: true,
+	}
+
+	if *mtls {
+		leaf, err := tls.LoadX509KeyPair(paths.LeafCert, paths.LeafKey)
+		if err != nil {
+			return fmt.Errorf("couldn't load client certificate, %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{leaf}
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: probeTimeout}, "tcp", addr, cfg)
+	if err != nil {
+		return fmt.Errorf("couldn't connect to %q, %w", addr, err)
+	}
+	defer conn.Close()
+
+	chain := conn.ConnectionState().PeerCertificates
+	for i, cert := range chain {
+		fmt.Printf("[%d]\n", i)
+		printCertificate(os.Stdout, cert)
+		fmt.Println()
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		fmt.Println("Verification: FAILED")
+		return fmt.Errorf("chain presented by %q doesn't verify against the local CA, %w", addr, err)
+	}
+
+	fmt.Println("Verification: OK")
+	return nil
+}
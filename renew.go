@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// renewKeyPath returns where the key of the leaf at certPath is expected,
+// following the client.pem and client-key.pem naming.
+func renewKeyPath(certPath string) string {
+	return strings.TrimSuffix(certPath, filepath.Ext(certPath)) + "-key.pem"
+}
+
+// loadRenewal reads the leaf given with -renew and, with -reuse-key, its
+// private key into opts, so the next leaf reissues it.
+func (o *options) loadRenewal() error {
+	if o.renew == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(o.renew)
+	if err != nil {
+		return fmt.Errorf("couldn't read the certificate to renew, %w", err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %q, %w", o.renew, err)
+	}
+	o.Renew = certs[0]
+
+	if o.reuseKey {
+		keyPath := renewKeyPath(o.renew)
+		key, err := loadPrivateKey(keyPath, o.keyPassword)
+		if err != nil {
+			return fmt.Errorf("-reuse-key needs the key of the renewed leaf, %w", err)
+		}
+		if !tlsgen.KeyMatches(key, o.Renew.PublicKey) {
+			return fmt.Errorf("%q and %q: %w", o.renew, keyPath, ErrKeyMismatch)
+		}
+		o.LeafKey = key
+	}
+
+	o.logger.Infof("Renewing %s from %q, which expires on %s\n", o.Renew.Subject, o.renew, o.Renew.NotAfter.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// validateRenew rejects options that set the identity of the leaf, which
+// -renew takes from the renewed certificate, or issue more than one leaf.
+func (o *options) validateRenew() error {
+	if o.reuseKey && o.renew == "" {
+		return fmt.Errorf("-reuse-key requires -renew")
+	}
+
+	if o.renew == "" {
+		return nil
+	}
+
+	conflicts := []conflict{
+		{len(o.DNSNames) > 0, "-dns"},
+		{len(o.IPAddresses) > 0, "-ip"},
+		{len(o.IPCIDRs) > 0, "-ip-cidr"},
+		{len(o.Emails) > 0, "-email"},
+		{len(o.URIs) > 0, "-uri"},
+		{o.CommonName != "", "-cn"},
+		{o.CNFromSPIFFE, "-cn-from-spiffe"},
+		{o.SubjectDER != nil, "-subject-der"},
+		{o.SPIFFEID != "", "-spiffe-id"},
+		{o.K8sNamespace != "", "-k8s-namespace and -k8s-sa"},
+		{o.count > 1, "-count"},
+		{len(o.names) > 0, "-name"},
+		{o.csr, "-csr"},
+		{o.signCSR != "", "-sign-csr"},
+	}
+	if err := conflictError("-renew keeps the subject and SANs of the renewed leaf and can't be combined with", conflicts); err != nil {
+		return err
+	}
+
+	if o.reuseKey && o.certOnly {
+		return fmt.Errorf("-reuse-key and -cert-only both pick the key to keep, use only one")
+	}
+
+	return nil
+}
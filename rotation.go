@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// generationFormat sorts lexically in chronological order
+	generationFormat = "20060102T150405.000Z"
+	currentLink      = "current"
+)
+
+// clientDir is the directory holding leaf certificates, relative to tlsDir.
+func clientDir() string {
+	return filepath.Dir(certificateFilePath)
+}
+
+// newGeneration creates a fresh timestamped directory for this run's leaves
+// and returns its path relative to tlsDir.
+func newGeneration(now time.Time) (string, error) {
+	name := filepath.Join(clientDir(), now.UTC().Format(generationFormat))
+	if err := os.Mkdir(filepath.Join(tlsDir, name), 0700); err != nil {
+		return "", fmt.Errorf("couldn't create generation directory, %w", err)
+	}
+
+	return name, nil
+}
+
+// activateGeneration atomically points the `current` symlink at generation.
+func activateGeneration(generation string) error {
+	link := filepath.Join(tlsDir, clientDir(), currentLink)
+	tmp := link + ".tmp"
+
+	_ = os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(generation), tmp); err != nil {
+		return fmt.Errorf("couldn't link current generation, %w", err)
+	}
+
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("couldn't link current generation, %w", err)
+	}
+
+	return nil
+}
+
+// pruneGenerations removes all but the newest keep timestamped directories.
+// The directory `current` points to is never removed.
+func pruneGenerations(l *logger, keep int) error {
+	dir := filepath.Join(tlsDir, clientDir())
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("couldn't list generations, %w", err)
+	}
+
+	current, _ := os.Readlink(filepath.Join(dir, currentLink))
+
+	var generations []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(generationFormat, e.Name()); err != nil {
+			continue
+		}
+		generations = append(generations, e.Name())
+	}
+
+	if len(generations) <= keep {
+		return nil
+	}
+
+	sort.Strings(generations)
+	for _, name := range generations[:len(generations)-keep] {
+		if name == current {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("couldn't remove old generation %q, %w", name, err)
+		}
+		l.Infof("Removed old generation %q\n", name)
+	}
+
+	return nil
+}
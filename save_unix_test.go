@@ -0,0 +1,60 @@
+//go:build unix
+
+package main
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSaveWithPathsPermissions(t *testing.T) {
+	// a permissive umask must not widen the key's permissions
+	defer syscall.Umask(syscall.Umask(0))
+
+	defer func(dir string) { tlsDir = dir }(tlsDir)
+
+	for _, existing := range []bool{false, true} {
+		tlsDir = t.TempDir()
+		dir := filepath.Join(tlsDir, "client")
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+
+		if existing {
+			// files from an earlier run with too loose permissions
+			for _, path := range []string{certPath, keyPath} {
+				if err := os.WriteFile(path, nil, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		key := &pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}
+		if err := saveWithPaths([][]byte{[]byte("cert")}, key, certPath, keyPath); err != nil {
+			t.Fatal(err)
+		}
+
+		for path, want := range map[string]os.FileMode{certPath: 0644, keyPath: 0600} {
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fi.Mode().Perm(); got != want {
+				t.Errorf("%s (existing %t) has mode %o, want %o", filepath.Base(path), existing, got, want)
+			}
+		}
+
+		// the lock stays in the -out directory, out of the leaf's
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("got %d files in the leaf directory, want only the pair", len(entries))
+		}
+	}
+}
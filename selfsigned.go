@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// generateSelfSigned writes a self-signed leaf and its key to the regular
+// leaf location, without reading or creating a CA.
+func generateSelfSigned(opts *options) error {
+	leaf, err := tlsgen.GenerateSelfSigned(&opts.Options)
+	if err != nil {
+		return err
+	}
+
+	keyBlock, err := privateKeyBlock(leaf, opts.keyPassword)
+	if err != nil {
+		return err
+	}
+
+	if opts.stdout {
+		return writeStdout(os.Stdout, leaf.Chain, keyBlock)
+	}
+
+	if err := createCertDir(opts.logger); err != nil {
+		return err
+	}
+
+	if err := createLeafDirs(opts); err != nil {
+		return err
+	}
+
+	certPath, keyPath := leafPaths(opts)
+	if err := saveWithPaths(leaf.Chain, keyBlock, certPath, keyPath); err != nil {
+		return err
+	}
+
+	if opts.ledger {
+		if err := recordIssued(leaf.Cert); err != nil {
+			return err
+		}
+	}
+
+	metrics := []certMetric{{role: "leaf", path: certPath, keyPath: keyPath, cert: leaf.Cert}}
+	logFingerprints(opts.logger, metrics, opts.fingerprintFormat)
+
+	if opts.json {
+		if err := printSummary(os.Stdout, metrics); err != nil {
+			return err
+		}
+	}
+
+	if opts.textfileOut != "" {
+		if err := writeTextfile(opts.textfileOut, metrics); err != nil {
+			return err
+		}
+	}
+
+	opts.logger.Infof("Self-signed certificate written to %q, clients have to trust it directly\n", certPath)
+	return nil
+}
+
+// validateSelfSigned rejects options that need a CA, which -self-signed
+// neither reads nor writes, or that issue more than one leaf.
+func (o *options) validateSelfSigned() error {
+	if !o.selfSigned {
+		return nil
+	}
+
+	conflicts := append([]conflict{
+		{o.count > 1, "-count"},
+		{len(o.names) > 0, "-name"},
+		{o.csr, "-csr"},
+		{o.signCSR != "", "-sign-csr"},
+		{o.renew != "", "-renew"},
+		{o.crl, "-crl"},
+		{o.ocspResponse != "", "-ocsp-response"},
+		{o.certOnly, "-cert-only"},
+		{o.timestampDir, "-timestamp-dir"},
+		{o.chain, "-chain"},
+		{caCertFile != "", "-ca-cert and -ca-key"},
+	}, o.layoutConflicts()...)
+	return conflictError("-self-signed doesn't use a CA and can't be combined with", conflicts)
+}
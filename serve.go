@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+const (
+	serveDefaultPort     = 8443
+	serveDefaultResponse = "Hello from tlsgen-dev\n"
+)
+
+// serve implements the `serve` subcommand: it mints a throwaway CA and server
+// certificate in memory and serves a fixed response over HTTPS. The CA PEM is
+// written to stdout so clients can add it to their trust store.
+func serve(args []string) error {
+	opts := newOptions()
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.Int("port", serveDefaultPort, "Port to listen on")
+	response := fs.String("response", serveDefaultResponse, "Fixed body returned for every request")
+	fs.Var((*stringSlice)(&opts.DNSNames), "dns", "DNS name to add as SAN to the server certificate (repeatable, default localhost)")
+	staple := fs.String("ocsp-staple", "", "Staple an OCSP response with this status to the handshake: "+strings.Join(tlsgen.OCSPStatuses, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := validateOCSPStatus("ocsp-staple", *staple); err != nil {
+		return err
+	}
+
+	if len(opts.DNSNames) == 0 {
+		opts.DNSNames = []string{"localhost"}
+	}
+	opts.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	ca, err := tlsgen.GenerateRootCA(&opts.Options)
+	if err != nil {
+		return err
+	}
+
+	leaf, err := tlsgen.GenerateLeaf(ca, &opts.Options)
+	if err != nil {
+		return err
+	}
+
+	cert := leaf.TLSCertificate()
+	if *staple != "" {
+		cert.OCSPStaple, err = tlsgen.CreateOCSPResponse(ca, leaf.Cert, *staple, &opts.Options)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := pem.Encode(os.Stdout, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Chain[0]}); err != nil {
+		return fmt.Errorf("couldn't encode CA pem: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr: fmt.Sprintf(":%d", *port),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, *response)
+		}),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	opts.logger.Infof("Serving HTTPS on %s\n", srv.Addr)
+	return srv.ListenAndServeTLS("", "")
+}
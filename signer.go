@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// caSigner provides the private key of a CA as a crypto.Signer, which is all
+// signing needs, so the key itself doesn't have to be readable.
+type caSigner interface {
+	// Signer returns the signer for the private key belonging to cert.
+	Signer(cert *x509.Certificate) (crypto.Signer, error)
+}
+
+// fileSigner is the default caSigner, it reads the key from a PEM file and
+// decrypts it with password if needed.
+type fileSigner struct {
+	path     string
+	password string
+}
+
+func (s fileSigner) Signer(cert *x509.Certificate) (crypto.Signer, error) {
+	key, err := loadPrivateKey(s.path, s.password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tlsgen.KeyMatches(key, cert.PublicKey) {
+		return nil, fmt.Errorf("%q and %s: %w", s.path, cert.Subject, ErrKeyMismatch)
+	}
+
+	return key, nil
+}
+
+// newCASigner returns the caSigner for the CA key at keyPath. It's the seam
+// for keys kept off the filesystem: a signer backed by a PKCS#11 token or a
+// KMS only has to implement caSigner and be returned here, e.g. for a
+// pkcs11: URI given as -ca-key.
+var newCASigner = func(keyPath, password string) caSigner {
+	return fileSigner{path: keyPath, password: password}
+}
+
+// loadCA reads the CA certificate, followed by any chain, from the PEM file
+// at certPath and pairs it with the key signer provides.
+func loadCA(certPath string, signer caSigner) (*tlsgen.CertBundle, error) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse %q, %w", certPath, err)
+	}
+
+	key, err := signer.Signer(certs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([][]byte, 0, len(certs))
+	for _, cert := range certs {
+		chain = append(chain, cert.Raw)
+	}
+
+	return tlsgen.NewCertBundle(chain, key)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// status prints how long the root CA and the leaf in tlsDir remain valid and
+// fails when either of them already expired.
+func status(opts *options) error {
+	if opts.timestampDir {
+		opts.generation = filepath.Join(clientDir(), currentLink)
+	}
+	leafPath, _ := leafPaths(opts)
+
+	now := time.Now()
+	var errs []error
+	for _, c := range []struct{ role, path string }{
+		{"CA", rootCertPath()},
+		{"Leaf", leafPath},
+	} {
+		remaining, err := remainingValidity(c.path, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		fmt.Printf("%-5s %s: %s (%d seconds)\n", c.role+":", c.path, formatRemaining(remaining), int64(remaining/time.Second))
+		if remaining <= 0 {
+			errs = append(errs, fmt.Errorf("%s certificate %q expired", c.role, c.path))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// remainingValidity returns the time left until the first certificate in the
+// PEM file at path expires, negative when it already did.
+func remainingValidity(path string, now time.Time) (time.Duration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read %q, %w", path, err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't parse %q, %w", path, err)
+	}
+
+	return certs[0].NotAfter.Sub(now), nil
+}
+
+// formatRemaining renders d in days, hours and minutes.
+func formatRemaining(d time.Duration) string {
+	if d <= 0 {
+		return fmt.Sprintf("expired %s ago", formatDuration(-d))
+	}
+
+	return fmt.Sprintf("expires in %s", formatDuration(d))
+}
+
+// formatDuration renders d rounded to the minute as e.g. 3650d, 2d5h or
+// 5h30m, leaving out zero units.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	n, h, m := days(d), int(d/time.Hour)%24, int(d/time.Minute)%60
+
+	var s string
+	for _, u := range []struct {
+		n    int
+		unit string
+	}{{n, "d"}, {h, "h"}, {m, "m"}} {
+		if u.n > 0 {
+			s += fmt.Sprintf("%d%s", u.n, u.unit)
+		}
+	}
+	if s == "" {
+		return "0m"
+	}
+
+	return s
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatRemaining(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		3650 * 24 * time.Hour:                      "expires in 3650d",
+		2*24*time.Hour + 5*time.Hour:               "expires in 2d5h",
+		24*time.Hour + 30*time.Minute:              "expires in 1d30m",
+		5*time.Hour + 30*time.Minute + time.Second: "expires in 5h30m",
+		-90 * time.Minute:                          "expired 1h30m ago",
+		20 * time.Second:                           "expires in 0m",
+	} {
+		if got := formatRemaining(d); got != want {
+			t.Errorf("formatRemaining(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
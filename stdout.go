@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+)
+
+// writeStdout writes certs followed by key as PEM to w, the -stdout
+// replacement for saveWithPaths. Consumers tell the blocks apart by type. A
+// nil key only writes the certificates.
+func writeStdout(w io.Writer, certs [][]byte, key *pem.Block) error {
+	for _, cert := range certs {
+		if err := pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert}); err != nil {
+			return fmt.Errorf("couldn't encode certificate pem: %w", err)
+		}
+	}
+
+	if key == nil {
+		return nil
+	}
+
+	if err := pem.Encode(w, key); err != nil {
+		return fmt.Errorf("couldn't encode private pem: %w", err)
+	}
+
+	return nil
+}
+
+// validateStdout rejects options that write files, which -stdout is meant to
+// avoid, or print to stdout themselves.
+func (o *options) validateStdout() error {
+	if !o.stdout {
+		return nil
+	}
+
+	conflicts := append([]conflict{
+		{o.count > 1, "-count"},
+		{o.certOnly, "-cert-only"},
+		{o.timestampDir, "-timestamp-dir"},
+		{o.certDir != "" || o.keyDir != "", "-cert-dir and -key-dir"},
+		{o.nameTpl != "" || o.keyNameTpl != "", "-name-template and -key-name-template"},
+		{o.csr, "-csr"},
+		{o.ledger, "-ledger"},
+		{o.textfileOut != "", "-textfile-out"},
+		{o.json, "-json"},
+	}, o.layoutConflicts()...)
+
+	return conflictError("-stdout doesn't write any files and can't be combined with", conflicts)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// artifactSummary describes a generated certificate for -json.
+type artifactSummary struct {
+	Role              string    `json:"role"`
+	CertPath          string    `json:"cert_path"`
+	KeyPath           string    `json:"key_path,omitempty"`
+	Serial            string    `json:"serial"`
+	Subject           string    `json:"subject"`
+	SANs              []string  `json:"sans,omitempty"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
+}
+
+// printSummary writes one JSON object per certificate in metrics to w, a
+// single line each, so scripts can consume it without parsing the log.
+func printSummary(w io.Writer, metrics []certMetric) error {
+	enc := json.NewEncoder(w)
+	for _, m := range metrics {
+		sum := sha256.Sum256(m.cert.Raw)
+		err := enc.Encode(artifactSummary{
+			Role:              m.role,
+			CertPath:          m.path,
+			KeyPath:           m.keyPath,
+			Serial:            fmt.Sprintf("%x", m.cert.SerialNumber),
+			Subject:           m.cert.Subject.String(),
+			SANs:              subjectAltNames(m.cert),
+			NotBefore:         m.cert.NotBefore.UTC(),
+			NotAfter:          m.cert.NotAfter.UTC(),
+			SHA256Fingerprint: colonHex(sum[:]),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't encode the summary, %w", err)
+		}
+	}
+
+	return nil
+}
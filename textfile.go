@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+const textfileMetric = "tlsgen_certificate_not_after_seconds"
+
+// certMetric is a certificate reported in a node_exporter textfile or the
+// -json summary.
+type certMetric struct {
+	role string
+	path string
+	// keyPath is empty when the key wasn't written in this run
+	keyPath string
+	cert    *x509.Certificate
+}
+
+// writeTextfile writes the expiry of every certificate in metrics in the
+// node_exporter textfile collector format. The file is replaced atomically
+// as the collector requires.
+func writeTextfile(path string, metrics []certMetric) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s Unix time after which the certificate is no longer valid.\n", textfileMetric)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", textfileMetric)
+
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "%s{role=\"%s\",path=\"%s\",serial=\"%x\",subject=\"%s\"} %d\n",
+			textfileMetric,
+			escapeLabel(m.role),
+			escapeLabel(m.path),
+			m.cert.SerialNumber,
+			escapeLabel(m.cert.Subject.String()),
+			m.cert.NotAfter.Unix(),
+		)
+	}
+
+	return writeFile(path, 0644, []byte(b.String()))
+}
+
+// escapeLabel escapes a Prometheus label value.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
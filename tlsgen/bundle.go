@@ -0,0 +1,78 @@
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// CertBundle is an issued certificate together with its private key, both
+// parsed and PEM encoded, ready to be used in-process or written out.
+type CertBundle struct {
+	// Cert is the parsed certificate, the first one of Chain
+	Cert *x509.Certificate
+	Key  crypto.Signer
+	// Chain holds the DER certificates from Cert up to the root, when known
+	Chain [][]byte
+	// CertPEM holds Cert only, KeyPEM the unencrypted Key, which is empty
+	// when Key can't be exported, e.g. a PKCS#11 or KMS backed signer
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// NewCertBundle pairs the DER chain, which starts with the certificate of
+// key, with key. key may be any crypto.Signer, only the in-memory key types
+// of the standard library are PEM encoded into KeyPEM.
+func NewCertBundle(chain [][]byte, key crypto.Signer) (*CertBundle, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates given")
+	}
+
+	cert, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("certificate contains errors, %w", err)
+	}
+
+	if !KeyMatches(key, cert.PublicKey) {
+		return nil, fmt.Errorf("%s: %w", cert.Subject, ErrKeyMismatch)
+	}
+
+	b := &CertBundle{
+		Cert:    cert,
+		Key:     key,
+		Chain:   chain,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[0]}),
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		keyBlock, err := MarshalPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		b.KeyPEM = pem.EncodeToMemory(keyBlock)
+	}
+
+	return b, nil
+}
+
+// TLSCertificate returns b for use in tls.Config Certificates. Peers get
+// the whole chain, a root at its end is harmless and ignored by verifiers.
+func (b *CertBundle) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: b.Chain,
+		PrivateKey:  b.Key,
+		Leaf:        b.Cert,
+	}
+}
+
+// Root returns the last certificate of the chain, the root CA as far as b
+// knows it.
+func (b *CertBundle) Root() []byte {
+	return b.Chain[len(b.Chain)-1]
+}
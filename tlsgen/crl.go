@@ -0,0 +1,45 @@
+package tlsgen
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// GenerateCRL returns a DER encoded CRL signed by ca that revokes the
+// certificates with the serial numbers in revoked, valid for Options.CRLTTL.
+// The CRL number is the issuing time in Unix seconds, so a later CRL always
+// supersedes an earlier one without keeping state.
+func GenerateCRL(ca *CertBundle, revoked []*big.Int, opts *Options) ([]byte, error) {
+	if err := CheckCAValidity(ca.Cert, time.Now()); err != nil {
+		return nil, fmt.Errorf("can't sign a CRL with %s, %w, regenerate it", ca.Cert.Subject, err)
+	}
+
+	if ca.Cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, fmt.Errorf("%s doesn't have the cRLSign key usage, regenerate it to sign CRLs", ca.Cert.Subject)
+	}
+
+	now := opts.now()
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, serial := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: now})
+	}
+
+	tpl := &x509.RevocationList{
+		SignatureAlgorithm:        SignatureAlgorithm(ca.Key.Public()),
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(now.Unix()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(opts.CRLTTL),
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, tpl, ca.Cert, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate CRL, %w", err)
+	}
+
+	return der, nil
+}
@@ -0,0 +1,58 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestGenerateCRL(t *testing.T) {
+	ca, leaf := newTestChain(t)
+
+	opts := DefaultOptions()
+	revoked := []*big.Int{leaf.Cert.SerialNumber, big.NewInt(42)}
+	der, err := GenerateCRL(ca, revoked, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Fatalf("CRL isn't signed by the CA, %v", err)
+	}
+
+	if len(crl.RevokedCertificateEntries) != len(revoked) {
+		t.Fatalf("got %d revoked entries, want %d", len(crl.RevokedCertificateEntries), len(revoked))
+	}
+	for i, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(revoked[i]) != 0 {
+			t.Errorf("entry %d has serial %x, want %x", i, entry.SerialNumber, revoked[i])
+		}
+	}
+
+	if got := crl.NextUpdate.Sub(crl.ThisUpdate); got != opts.CRLTTL.Truncate(time.Second) {
+		t.Errorf("CRL is valid for %s, want %s", got, opts.CRLTTL)
+	}
+}
+
+func TestGenerateCRLEmpty(t *testing.T) {
+	ca, _ := newTestChain(t)
+
+	opts := DefaultOptions()
+	der, err := GenerateCRL(ca, nil, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 0 {
+		t.Fatalf("empty CRL revokes %d certificates", len(crl.RevokedCertificateEntries))
+	}
+}
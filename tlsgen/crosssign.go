@@ -0,0 +1,59 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// CrossSign returns a DER encoded copy of cert signed by ca instead of its
+// original issuer, e.g. to make a leaf or intermediate chain to a new root
+// during a root rotation. Subject, public key, serial, validity and
+// extensions are kept, only the issuer, the authority key identifier and the
+// signature change. cert may be a leaf or a CA, and must expire before ca.
+func CrossSign(ca *CertBundle, cert *x509.Certificate, opts *Options) ([]byte, error) {
+	if !ca.Cert.IsCA {
+		return nil, fmt.Errorf("%s can't cross-sign, %w", ca.Cert.Subject, ErrNotCA)
+	}
+
+	if err := CheckCAValidity(ca.Cert, time.Now()); err != nil {
+		return nil, fmt.Errorf("can't cross-sign with the -ca-cert2 CA %s, %w", ca.Cert.Subject, err)
+	}
+
+	// signLeaf's -leaf-ttl advice doesn't apply, the validity is copied
+	if cert.NotAfter.After(ca.Cert.NotAfter) {
+		return nil, fmt.Errorf("%s is valid until %s, after the -ca-cert2 CA %s expires on %s, use a -ca-cert2 that outlives it or reissue it with a shorter lifetime",
+			cert.Subject, cert.NotAfter.UTC().Format(time.RFC3339), ca.Cert.Subject, ca.Cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	tpl := *cert
+	// regenerated from the parsed fields or, for the AKI, from ca
+	tpl.ExtraExtensions = nil
+	for _, ext := range cert.Extensions {
+		if !generatedExtensions[ext.Id.String()] {
+			tpl.ExtraExtensions = append(tpl.ExtraExtensions, ext)
+		}
+	}
+	tpl.AuthorityKeyId = nil
+
+	// a pinned -aki belongs to the original issuer
+	crossOpts := *opts
+	crossOpts.AKI = nil
+
+	return signLeaf(ca, &tpl, cert.PublicKey, &crossOpts)
+}
+
+// generatedExtensions are the extensions x509.CreateCertificate builds from
+// the template fields of a parsed certificate.
+var generatedExtensions = map[string]bool{
+	"2.5.29.14":         true, // subject key identifier
+	"2.5.29.15":         true, // key usage
+	"2.5.29.17":         true, // subject alternative name
+	"2.5.29.19":         true, // basic constraints
+	"2.5.29.30":         true, // name constraints
+	"2.5.29.31":         true, // CRL distribution points
+	"2.5.29.32":         true, // certificate policies
+	"2.5.29.35":         true, // authority key identifier
+	"2.5.29.37":         true, // extended key usage
+	"1.3.6.1.5.5.7.1.1": true, // authority information access
+}
@@ -0,0 +1,85 @@
+package tlsgen
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+)
+
+func TestCrossSign(t *testing.T) {
+	opts := DefaultOptions()
+	opts.KeyType = KeyTypeECDSAP256
+
+	oldRoot, err := GenerateRootCA(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRoot, err := GenerateRootCA(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediate, err := GenerateIntermediateCA(oldRoot, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := GenerateLeaf(intermediate, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := CrossSign(newRoot, intermediate.Cert, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cross.SerialNumber.Cmp(intermediate.Cert.SerialNumber) != 0 || !bytes.Equal(cross.RawSubject, intermediate.Cert.RawSubject) ||
+		!bytes.Equal(cross.RawSubjectPublicKeyInfo, intermediate.Cert.RawSubjectPublicKeyInfo) {
+		t.Fatal("cross-signed copy has a different serial, subject or key")
+	}
+	if !bytes.Equal(cross.AuthorityKeyId, newRoot.Cert.SubjectKeyId) {
+		t.Fatal("cross-signed copy kept the original authority key identifier")
+	}
+
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.Cert)
+	intermediates.AddCert(cross)
+
+	for name, root := range map[string]*CertBundle{"old root": oldRoot, "new root": newRoot} {
+		roots := x509.NewCertPool()
+		roots.AddCert(root.Cert)
+
+		_, err := leaf.Cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			t.Errorf("leaf doesn't verify against the %s, %v", name, err)
+		}
+	}
+}
+
+func TestCrossSignOutlivesCA(t *testing.T) {
+	opts := DefaultOptions()
+	opts.KeyType = KeyTypeECDSAP256
+
+	ca, leaf := newTestChain(t)
+
+	opts.CATTL = leaf.Cert.NotAfter.Sub(leaf.Cert.NotBefore) / 2
+	shortRoot, err := GenerateRootCA(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CrossSign(shortRoot, leaf.Cert, &opts); err == nil {
+		t.Fatal("leaf outliving the cross-signing CA was signed")
+	}
+	if _, err := CrossSign(leaf, ca.Cert, &opts); err == nil {
+		t.Fatal("leaf was used to cross-sign")
+	}
+}
@@ -0,0 +1,34 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotCA is returned when a certificate expected to be a CA isn't one.
+	ErrNotCA = errors.New("this is not a root certificate")
+	// ErrKeyMismatch is returned when a private key doesn't belong to the
+	// certificate it was loaded with.
+	ErrKeyMismatch = errors.New("private key does not match the certificate public key")
+	// ErrCAExpired is returned when a CA certificate is past its NotAfter.
+	ErrCAExpired = errors.New("ca certificate has expired")
+	// ErrCANotYetValid is returned when a CA certificate is before its NotBefore.
+	ErrCANotYetValid = errors.New("ca certificate is not yet valid")
+)
+
+// CheckCAValidity returns ErrCAExpired or ErrCANotYetValid when ca can't be
+// used to sign at time now.
+func CheckCAValidity(ca *x509.Certificate, now time.Time) error {
+	if now.After(ca.NotAfter) {
+		return fmt.Errorf("%w on %s", ErrCAExpired, ca.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	if now.Before(ca.NotBefore) {
+		return fmt.Errorf("%w until %s", ErrCANotYetValid, ca.NotBefore.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
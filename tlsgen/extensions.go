@@ -0,0 +1,126 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sort"
+)
+
+var (
+	oidExtensionAuthorityKeyID = asn1.ObjectIdentifier{2, 5, 29, 35}
+	// Netscape certificate type, still checked by OpenVPN's --ns-cert-type
+	oidExtensionNSCertType = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 1}
+	// TLS Feature (RFC 7633)
+	oidExtensionTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	// IP Security IKE Intermediate (RFC 4945), some IKEv2 peers require it
+	oidExtKeyUsageIKEIntermediate = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 8, 2, 2}
+)
+
+// tlsFeatureStatusRequest is the status_request TLS extension number, which
+// in a TLS Feature extension means OCSP must-staple.
+const tlsFeatureStatusRequest = 5
+
+// nsCertType bits, bit 0 being the most significant.
+const (
+	nsCertTypeClient = 0
+	nsCertTypeServer = 1
+)
+
+// authorityKeyIdentifier is the issuer+serial form of the RFC 5280 AKI
+// extension. The keyIdentifier field is deliberately omitted.
+type authorityKeyIdentifier struct {
+	CertIssuer asn1.RawValue
+	CertSerial *big.Int `asn1:"tag:2"`
+}
+
+// issuerSerialAKI builds an Authority Key Identifier extension that references
+// the issuing CA by its issuer DN and serial number instead of its key id.
+// When present in ExtraExtensions it replaces the one Go would generate.
+func issuerSerialAKI(ca *x509.Certificate) (pkix.Extension, error) {
+	// GeneralName directoryName [4] wrapping the CA's issuer Name
+	dirName, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        4,
+		IsCompound: true,
+		Bytes:      ca.RawIssuer,
+	})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	value, err := asn1.Marshal(authorityKeyIdentifier{
+		CertIssuer: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1,
+			IsCompound: true,
+			Bytes:      dirName,
+		},
+		CertSerial: ca.SerialNumber,
+	})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: value}, nil
+}
+
+// keyIDAKI builds an Authority Key Identifier extension holding keyID, for
+// pointing a leaf at a specific CA certificate among several sharing a key.
+func keyIDAKI(keyID []byte) (pkix.Extension, error) {
+	value, err := asn1.Marshal(struct {
+		KeyIdentifier []byte `asn1:"tag:0"`
+	}{keyID})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: value}, nil
+}
+
+// mustStapleExtension builds a TLS Feature extension requiring the server to
+// staple an OCSP response.
+func mustStapleExtension() (pkix.Extension, error) {
+	value, err := asn1.Marshal([]int{tlsFeatureStatusRequest})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: oidExtensionTLSFeature, Value: value}, nil
+}
+
+// sortExtensions orders extensions by OID so that the DER encoding doesn't
+// depend on the order in which they were added to ExtraExtensions. Go appends
+// ExtraExtensions after the ones it generates itself, in slice order.
+func sortExtensions(exts []pkix.Extension) {
+	sort.SliceStable(exts, func(i, j int) bool {
+		return compareOID(exts[i].Id, exts[j].Id) < 0
+	})
+}
+
+// compareOID compares two object identifiers arc by arc.
+func compareOID(a, b asn1.ObjectIdentifier) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+// nsCertTypeExtension builds a Netscape certificate type extension with the
+// given bit set.
+func nsCertTypeExtension(bit int) pkix.Extension {
+	// minimal DER, the bit string ends at the last set bit
+	value, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x80 >> bit}, BitLength: bit + 1})
+	if err != nil {
+		panic(err)
+	}
+
+	return pkix.Extension{Id: oidExtensionNSCertType, Value: value}
+}
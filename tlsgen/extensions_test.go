@@ -0,0 +1,77 @@
+package tlsgen
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareOID(t *testing.T) {
+	for _, tc := range []struct {
+		a, b asn1.ObjectIdentifier
+		want int
+	}{
+		{asn1.ObjectIdentifier{2, 5, 29, 9}, asn1.ObjectIdentifier{2, 5, 29, 17}, -1},
+		{asn1.ObjectIdentifier{2, 5, 29, 17}, asn1.ObjectIdentifier{2, 5, 29, 9}, 1},
+		{asn1.ObjectIdentifier{2, 5, 29, 17}, asn1.ObjectIdentifier{2, 5, 29, 17}, 0},
+		{asn1.ObjectIdentifier{2, 5, 29}, asn1.ObjectIdentifier{2, 5, 29, 1}, -1},
+		{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}, asn1.ObjectIdentifier{2, 5, 29, 1}, -1},
+	} {
+		got := compareOID(tc.a, tc.b)
+		if (got < 0) != (tc.want < 0) || (got > 0) != (tc.want > 0) {
+			t.Errorf("compareOID(%s, %s) = %d, want the sign of %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSortExtensions(t *testing.T) {
+	want := []pkix.Extension{
+		{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}},
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 9}},
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 17}},
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 35}},
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 35, 1}},
+	}
+
+	for _, order := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 4, 0, 3, 1}, {3, 2, 1, 4, 0}} {
+		exts := make([]pkix.Extension, 0, len(want))
+		for _, i := range order {
+			exts = append(exts, want[i])
+		}
+
+		sortExtensions(exts)
+		if !reflect.DeepEqual(exts, want) {
+			t.Errorf("order %v sorted to %v, want %v", order, exts, want)
+		}
+	}
+}
+
+func TestSortedExtensionsReproducible(t *testing.T) {
+	extra := []pkix.Extension{
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 10}, Value: []byte{0x05, 0x00}},
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 9}, Value: []byte{0x05, 0x00}},
+	}
+
+	generate := func(exts ...pkix.Extension) []byte {
+		opts := DefaultOptions()
+		opts.Seed, opts.KeyType = []byte("seed"), KeyTypeEd25519
+		opts.StartTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		opts.TemplateFunc = func(tpl *x509.Certificate) {
+			tpl.ExtraExtensions = append(tpl.ExtraExtensions, exts...)
+		}
+
+		ca, err := GenerateRootCA(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ca.CertPEM
+	}
+
+	if !bytes.Equal(generate(extra[0], extra[1]), generate(extra[1], extra[0])) {
+		t.Fatal("the order extensions were added in changed the certificate")
+	}
+}
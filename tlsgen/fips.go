@@ -0,0 +1,63 @@
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
+
+// minFIPSRSABits is the smallest RSA modulus FIPS 186-5 allows for signing.
+const minFIPSRSABits = 2048
+
+// checkFIPSKey rejects public keys outside the FIPS 186-5 approved
+// parameters: RSA of at least 2048 bits and ECDSA on P-256, P-384 or P-521.
+func checkFIPSKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minFIPSRSABits {
+			return fmt.Errorf("-fips requires RSA keys of at least %d bits, got %d", minFIPSRSABits, k.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("-fips doesn't allow the ECDSA curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return fmt.Errorf("-fips doesn't allow Ed25519 keys")
+	default:
+		return fmt.Errorf("-fips doesn't allow %T keys", pub)
+	}
+
+	return nil
+}
+
+// checkFIPSSignature rejects signature algorithms using SHA-1 or weaker.
+func checkFIPSSignature(alg x509.SignatureAlgorithm) error {
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+		x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return nil
+	}
+
+	return fmt.Errorf("-fips doesn't allow the %s signature algorithm", alg)
+}
+
+// checkFIPS applies the -fips policy to a certificate about to be signed by
+// signer for the subject key pub.
+func checkFIPS(tpl *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) error {
+	if err := checkFIPSKey(pub); err != nil {
+		return err
+	}
+
+	if err := checkFIPSKey(signer.Public()); err != nil {
+		return fmt.Errorf("signing key: %w", err)
+	}
+
+	return checkFIPSSignature(tpl.SignatureAlgorithm)
+}
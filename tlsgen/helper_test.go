@@ -0,0 +1,24 @@
+package tlsgen
+
+import "testing"
+
+// newTestChain returns a root CA and a leaf it issued, both with ECDSA P-256
+// keys, which are quick to generate.
+func newTestChain(t *testing.T) (*CertBundle, *CertBundle) {
+	t.Helper()
+
+	opts := DefaultOptions()
+	opts.KeyType = KeyTypeECDSAP256
+
+	ca, err := GenerateRootCA(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := GenerateLeaf(ca, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ca, leaf
+}
@@ -0,0 +1,587 @@
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const intermediateLabel = "intermediate"
+
+// GenerateRootCA creates a new self-signed root CA entirely in memory.
+func GenerateRootCA(opts *Options) (*CertBundle, error) {
+	// create private key
+	key, err := generateKey(opts, opts.certLabel(true))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate a private key, %w", err)
+	}
+
+	// create certificate template
+	tpl, err := RootTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl.SignatureAlgorithm = SignatureAlgorithm(key.Public())
+
+	if opts.TemplateFunc != nil {
+		opts.TemplateFunc(tpl)
+	}
+	sortExtensions(tpl.ExtraExtensions)
+
+	if opts.FIPS {
+		if err := checkFIPS(tpl, key.Public(), key); err != nil {
+			return nil, err
+		}
+	}
+
+	derBytes, err := x509.CreateCertificate(opts.random(opts.certLabel(true)+"/sign"), tpl, tpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate new certificate %w", err)
+	}
+
+	return newBundle([][]byte{derBytes}, key)
+}
+
+// GenerateIntermediateCA creates a new intermediate CA signed by root
+// entirely in memory. It can only sign leaves, and its validity is capped at
+// the root's. The returned chain holds the intermediate followed by root.
+func GenerateIntermediateCA(root *CertBundle, opts *Options) (*CertBundle, error) {
+	if err := CheckCAValidity(root.Cert, time.Now()); err != nil {
+		return nil, fmt.Errorf("can't sign with %s, %w, regenerate it", root.Cert.Subject, err)
+	}
+
+	key, err := generateKey(opts, intermediateLabel)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate a private key, %w", err)
+	}
+
+	tpl, err := IntermediateTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if tpl.NotAfter.After(root.Cert.NotAfter) {
+		tpl.NotAfter = root.Cert.NotAfter
+	}
+
+	tpl.SignatureAlgorithm = SignatureAlgorithm(root.Key.Public())
+
+	if opts.TemplateFunc != nil {
+		opts.TemplateFunc(tpl)
+	}
+	sortExtensions(tpl.ExtraExtensions)
+
+	if opts.FIPS {
+		if err := checkFIPS(tpl, key.Public(), root.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	derBytes, err := x509.CreateCertificate(opts.random(intermediateLabel+"/sign"), tpl, root.Cert, key.Public(), root.Key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate new certificate %w", err)
+	}
+
+	return newBundle([][]byte{derBytes, root.Chain[0]}, key)
+}
+
+// GenerateLeaf creates a new leaf certificate signed by ca entirely in
+// memory. The first certificate of the ca chain is the issuer.
+func GenerateLeaf(ca *CertBundle, opts *Options) (*CertBundle, error) {
+	// create private key, unless an existing one is reused
+	key := opts.LeafKey
+	if key == nil {
+		var err error
+		key, err = GenerateKey(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// create certificate template
+	tpl, err := LeafTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := signLeaf(ca, tpl, key.Public(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBundle([][]byte{derBytes}, key)
+}
+
+// GenerateSelfSigned creates a leaf certificate signed by its own key
+// entirely in memory, for quick experiments that don't need a CA. Peers
+// have to trust the certificate itself.
+func GenerateSelfSigned(opts *Options) (*CertBundle, error) {
+	key := opts.LeafKey
+	if key == nil {
+		var err error
+		key, err = GenerateKey(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tpl, err := LeafTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl.SignatureAlgorithm = SignatureAlgorithm(key.Public())
+	tpl.KeyUsage = leafKeyUsage(tpl.KeyUsage, key.Public())
+
+	if opts.TemplateFunc != nil {
+		opts.TemplateFunc(tpl)
+	}
+	sortExtensions(tpl.ExtraExtensions)
+
+	if opts.FIPS {
+		if err := checkFIPS(tpl, key.Public(), key); err != nil {
+			return nil, err
+		}
+	}
+
+	derBytes, err := x509.CreateCertificate(opts.random(opts.certLabel(false)+"/sign"), tpl, tpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate new certificate %w", err)
+	}
+
+	return newBundle([][]byte{derBytes}, key)
+}
+
+// SignCSR issues a leaf certificate for the public key of csr, signed by ca.
+// The subject and SANs are copied from csr, everything else, such as the
+// validity and key usage, comes from opts. The requester keeps the private
+// key, so only the certificate is returned.
+func SignCSR(ca *CertBundle, csr *x509.CertificateRequest, opts *Options) (*x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("certificate request signature is invalid, %w", err)
+	}
+
+	// held to the same rules as names given with flags
+	if !opts.AllowInvalidSAN {
+		uris := make([]string, 0, len(csr.URIs))
+		for _, u := range csr.URIs {
+			uris = append(uris, u.String())
+		}
+
+		if err := validateSANs(csr.DNSNames, csr.EmailAddresses, uris); err != nil {
+			return nil, fmt.Errorf("certificate request: %w", err)
+		}
+	}
+
+	if n := utf8.RuneCountInString(csr.Subject.CommonName); n > maxCommonNameLength && !opts.AllowLongCN {
+		return nil, fmt.Errorf("certificate request: common name is %d characters long, more than the X.509 upper bound of %d (use -allow-long-cn to issue it anyway)", n, maxCommonNameLength)
+	}
+
+	// not LeafTemplate, the key usage follows the request's key, not KeyType
+	tpl, err := newCertTemplate(false, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating certificate template, %w", err)
+	}
+
+	tpl.Subject = csr.Subject
+	tpl.RawSubject = csr.RawSubject
+	tpl.DNSNames = csr.DNSNames
+	tpl.IPAddresses = csr.IPAddresses
+	tpl.EmailAddresses = csr.EmailAddresses
+	tpl.URIs = csr.URIs
+
+	derBytes, err := signLeaf(ca, tpl, csr.PublicKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		return nil, fmt.Errorf("generated certificate contains errors, %w", err)
+	}
+
+	return cert, nil
+}
+
+// signLeaf completes the leaf template tpl for ca and signs it, certifying
+// pub.
+func signLeaf(ca *CertBundle, tpl *x509.Certificate, pub crypto.PublicKey, opts *Options) ([]byte, error) {
+	if err := CheckCAValidity(ca.Cert, time.Now()); err != nil {
+		return nil, fmt.Errorf("can't sign with %s, %w, regenerate it", ca.Cert.Subject, err)
+	}
+
+	if tpl.NotAfter.After(ca.Cert.NotAfter) {
+		return nil, fmt.Errorf("leaf would be valid until %s, after its CA expires on %s, use a shorter -leaf-ttl",
+			tpl.NotAfter.UTC().Format(time.RFC3339), ca.Cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	if opts.AKIMode == AKIModeIssuerSerial {
+		ext, err := issuerSerialAKI(ca.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't build authority key identifier, %w", err)
+		}
+		tpl.ExtraExtensions = append(tpl.ExtraExtensions, ext)
+	}
+
+	if opts.AKI != nil {
+		ext, err := keyIDAKI(opts.AKI)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't build authority key identifier, %w", err)
+		}
+		tpl.ExtraExtensions = append(tpl.ExtraExtensions, ext)
+	}
+
+	// follows the CA key, which may be of a different type than the leaf's
+	tpl.SignatureAlgorithm = SignatureAlgorithm(ca.Key.Public())
+	tpl.KeyUsage = leafKeyUsage(tpl.KeyUsage, pub)
+
+	if opts.TemplateFunc != nil {
+		opts.TemplateFunc(tpl)
+	}
+	sortExtensions(tpl.ExtraExtensions)
+
+	if opts.FIPS {
+		if err := checkFIPS(tpl, pub, ca.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	derBytes, err := x509.CreateCertificate(opts.random(opts.certLabel(false)+"/sign"), tpl, ca.Cert, pub, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate new certificate %w", err)
+	}
+
+	return derBytes, nil
+}
+
+// GenerateKey creates the private key of the leaf described by opts,
+// reproducibly when a seed is configured.
+func GenerateKey(opts *Options) (crypto.Signer, error) {
+	key, err := generateKey(opts, opts.certLabel(false))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate a private key, %w", err)
+	}
+
+	return key, nil
+}
+
+// RootTemplate returns the unsigned root CA certificate described by opts,
+// e.g. to inspect it before replacing an existing root.
+func RootTemplate(opts *Options) (*x509.Certificate, error) {
+	tpl, err := newCertTemplate(true, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating certificate template, %w", err)
+	}
+
+	return tpl, nil
+}
+
+// IntermediateTemplate returns the unsigned intermediate CA certificate
+// described by opts. GenerateIntermediateCA additionally caps its validity
+// at the root's.
+func IntermediateTemplate(opts *Options) (*x509.Certificate, error) {
+	tpl, err := RootTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// a distinct label keeps the serial apart from the root's with a seed
+	tpl.SerialNumber, err = newSerialNumber(opts, intermediateLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl.Subject.Organization = []string{opts.Organization + " INTERMEDIATE CA"}
+	tpl.SubjectKeyId = nil
+	tpl.MaxPathLen = 0
+	tpl.MaxPathLenZero = true
+
+	return tpl, nil
+}
+
+// LeafTemplate returns the unsigned leaf certificate described by opts, e.g.
+// to inspect it before issuing or to build a certificate request from it.
+func LeafTemplate(opts *Options) (*x509.Certificate, error) {
+	tpl, err := newCertTemplate(false, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating certificate template, %w", err)
+	}
+
+	// the key usage the leaf key, given or generated for KeyType, ends up with
+	if opts.LeafKey != nil {
+		tpl.KeyUsage = leafKeyUsage(tpl.KeyUsage, opts.LeafKey.Public())
+	} else if opts.KeyType != KeyTypeRSA {
+		tpl.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+
+	return tpl, nil
+}
+
+// newBundle validates a freshly signed chain and pairs it with its key.
+func newBundle(chain [][]byte, key crypto.Signer) (*CertBundle, error) {
+	bundle, err := NewCertBundle(chain, key)
+	if err != nil {
+		return nil, fmt.Errorf("generated certificate contains errors, %w", err)
+	}
+
+	return bundle, nil
+}
+
+// newSerialNumber returns a random serial number for the certificate
+// identified by label, or the fixed Options.Serial.
+func newSerialNumber(opts *Options, label string) (*big.Int, error) {
+	if opts.Serial != nil {
+		return new(big.Int).Set(opts.Serial), nil
+	}
+
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), uint(opts.SerialBits))
+	serialNumber, err := rand.Int(opts.random(label+"/serial"), serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number %w", err)
+	}
+
+	return serialNumber, nil
+}
+
+func newCertTemplate(root bool, opts *Options) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber(opts, opts.certLabel(root))
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := opts.now()
+	if !opts.NotBefore.IsZero() {
+		startTime = opts.NotBefore
+	}
+
+	lifetime := opts.LeafTTL
+	if root {
+		lifetime = opts.CATTL
+	}
+
+	notAfter := startTime.Add(lifetime)
+	if opts.NoExpiry {
+		// Go switches to GeneralizedTime on its own for years past 2049
+		notAfter = NoExpiryNotAfter
+	}
+
+	if !root && opts.ValidityJitter > 0 {
+		// uniform in [-jitter, +jitter], so a bulk run doesn't expire at once
+		span := big.NewInt(int64(2*opts.ValidityJitter) + 1)
+		offset, err := rand.Int(opts.random(opts.certLabel(root)+"/jitter"), span)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate validity jitter %w", err)
+		}
+		notAfter = notAfter.Add(time.Duration(offset.Int64()) - opts.ValidityJitter)
+	}
+
+	// tolerate verifiers with clocks running behind, without shortening the
+	// lifetime, which still counts from startTime
+	notBefore := startTime.Add(-opts.Backdate)
+	if !opts.NotBefore.IsZero() {
+		notBefore = opts.NotBefore
+	}
+
+	if opts.AlignUTCDay {
+		notBefore, notAfter = alignToUTCDay(notBefore, notAfter)
+	}
+
+	if !opts.NotAfter.IsZero() {
+		notAfter = opts.NotAfter
+		if !notAfter.After(notBefore) {
+			return nil, fmt.Errorf("-not-after %s isn't later than the start of the validity at %s, set -not-before too",
+				notAfter.UTC().Format(time.RFC3339), notBefore.UTC().Format(time.RFC3339))
+		}
+	}
+
+	tpl := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{opts.Organization}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+	}
+
+	if root {
+		tpl.Subject = pkix.Name{Organization: []string{opts.Organization + " ROOT CA"}}
+		tpl.IsCA = true
+		tpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		// when empty, Go derives it from the public key hash
+		tpl.SubjectKeyId = opts.CASKI
+
+		tpl.PermittedDNSDomains = opts.PermittedDNSDomains
+		tpl.ExcludedDNSDomains = opts.ExcludedDNSDomains
+		tpl.PermittedURIDomains = opts.PermittedURIDomains
+		// RFC 5280 requires name constraints to be critical
+		tpl.PermittedDNSDomainsCritical = len(opts.PermittedDNSDomains)+len(opts.ExcludedDNSDomains)+len(opts.PermittedURIDomains) > 0
+
+		return &tpl, nil
+	}
+
+	// signLeaf drops KeyEncipherment again unless the leaf key is RSA
+	tpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	switch opts.Usage {
+	case UsageServer:
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	case UsageClient:
+		// client keys only sign the handshake, they never encipher a key
+		tpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+
+	// add SPIFFE specifics which we must not have in the root
+	var spiffeID string
+	if opts.SPIFFE || opts.CNFromSPIFFE {
+		path, err := spiffePath(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		uri, err := newSPIFFEID(opts.SPIFFEDomain, path)
+		if err != nil {
+			return nil, err
+		}
+		spiffeID = uri.String()
+
+		if opts.SPIFFE {
+			tpl.URIs = []*url.URL{uri}
+		}
+	}
+
+	tpl.DNSNames = opts.DNSNames
+	tpl.IPAddresses = append(tpl.IPAddresses, opts.IPAddresses...)
+	for _, cidr := range opts.IPCIDRs {
+		ips, err := expandCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		tpl.IPAddresses = append(tpl.IPAddresses, ips...)
+	}
+
+	tpl.Subject.CommonName = opts.CommonName
+	if opts.CNFromSPIFFE {
+		// for legacy authZ that only looks at the CN
+		tpl.Subject.CommonName = spiffeID
+	}
+	tpl.EmailAddresses = opts.Emails
+	tpl.CRLDistributionPoints = opts.CRLURLs
+	tpl.OCSPServer = opts.OCSPURLs
+
+	if opts.MustStaple {
+		ext, err := mustStapleExtension()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't build tls feature extension, %w", err)
+		}
+		tpl.ExtraExtensions = append(tpl.ExtraExtensions, ext)
+	}
+
+	applyProfile(&tpl, opts)
+
+	// after the profile, which may only drop the SPIFFE ID
+	for _, v := range opts.URIs {
+		uri, err := url.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URI SAN %q, %w", v, err)
+		}
+		tpl.URIs = append(tpl.URIs, uri)
+	}
+
+	if r := opts.Renew; r != nil {
+		// the identity was validated when r was issued, only validity,
+		// serial and key usage are new
+		tpl.Subject = r.Subject
+		tpl.RawSubject = r.RawSubject
+		tpl.DNSNames = r.DNSNames
+		tpl.IPAddresses = r.IPAddresses
+		tpl.EmailAddresses = r.EmailAddresses
+		tpl.URIs = r.URIs
+
+		return &tpl, nil
+	}
+
+	if n := utf8.RuneCountInString(tpl.Subject.CommonName); n > maxCommonNameLength && !opts.AllowLongCN {
+		return nil, fmt.Errorf("common name is %d characters long, more than the X.509 upper bound of %d (use -allow-long-cn to issue it anyway)", n, maxCommonNameLength)
+	}
+
+	// takes precedence over Subject, for DNs pkix.Name can't reproduce
+	tpl.RawSubject = opts.SubjectDER
+
+	return &tpl, nil
+}
+
+// alignToUTCDay widens the validity window to whole UTC days, from 00:00:00Z
+// on the first day to 23:59:59Z on the last one.
+func alignToUTCDay(notBefore, notAfter time.Time) (time.Time, time.Time) {
+	nb, na := notBefore.UTC(), notAfter.UTC()
+
+	return time.Date(nb.Year(), nb.Month(), nb.Day(), 0, 0, 0, 0, time.UTC),
+		time.Date(na.Year(), na.Month(), na.Day(), 23, 59, 59, 0, time.UTC)
+}
+
+// spiffePath returns the path component of the leaf SPIFFE ID. When a k8s
+// identity is given it follows SPIRE's k8s workload attestor convention,
+// without one it falls back to SPIFFEID and then the hostname.
+func spiffePath(opts *Options) (string, error) {
+	if opts.K8sNamespace != "" {
+		return fmt.Sprintf("ns/%s/sa/%s", opts.K8sNamespace, opts.K8sSA), nil
+	}
+
+	if opts.SPIFFEID != "" {
+		return opts.SPIFFEID, nil
+	}
+
+	return getWorkloadID()
+}
+
+// now returns the current time, or Options.StartTime when set.
+func (o *Options) now() time.Time {
+	if !o.StartTime.IsZero() {
+		return o.StartTime
+	}
+
+	return time.Now()
+}
+
+// certLabel names the certificate for deriving seeded randomness, so every
+// leaf of a bulk run gets its own key and serial.
+func (o *Options) certLabel(root bool) string {
+	switch {
+	case root:
+		return "root"
+	case o.Index > 0:
+		return fmt.Sprintf("leaf/%d", o.Index)
+	default:
+		return "leaf"
+	}
+}
+
+// getWorkloadID returns the first label of the hostname. An empty one would
+// make the SPIFFE ID "spiffe://<domain>/", which verifiers reject.
+func getWorkloadID() (string, error) {
+	hn, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("couldn't determine the hostname for the SPIFFE ID, set -spiffe-id, %w", err)
+	}
+
+	id := strings.ToLower(strings.Split(hn, ".")[0])
+	if id == "" {
+		return "", fmt.Errorf("hostname %q has no leading label to use as SPIFFE ID, set -spiffe-id", hn)
+	}
+
+	if err := ValidateSPIFFEPath(id); err != nil {
+		return "", fmt.Errorf("hostname %q can't be used as SPIFFE ID, %w, set -spiffe-id", hn, err)
+	}
+
+	return id, nil
+}
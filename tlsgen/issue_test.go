@@ -0,0 +1,186 @@
+package tlsgen
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixedSerial(t *testing.T) {
+	limit := new(big.Int).Lsh(big.NewInt(1), MaxSerialBits)
+	for _, tc := range []struct {
+		serial *big.Int
+		valid  bool
+	}{
+		{big.NewInt(1), true},
+		{new(big.Int).Sub(limit, big.NewInt(1)), true},
+		{limit, false},
+		{big.NewInt(0), false},
+		{big.NewInt(-1), false},
+	} {
+		opts := DefaultOptions()
+		opts.Serial = tc.serial
+		if err := opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("serial %s: got error %v, want valid %t", tc.serial, err, tc.valid)
+		}
+	}
+
+	ca, _ := newTestChain(t)
+	opts := DefaultOptions()
+	opts.KeyType = KeyTypeECDSAP256
+	opts.Serial = big.NewInt(418)
+
+	leaf, err := GenerateLeaf(ca, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Cert.SerialNumber.Cmp(opts.Serial) != 0 {
+		t.Fatalf("got serial %s, want %s", leaf.Cert.SerialNumber, opts.Serial)
+	}
+}
+
+func TestLeafKeyEncipherment(t *testing.T) {
+	caOpts := DefaultOptions()
+	ca, err := GenerateRootCA(&caOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keyType := range KeyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.KeyType = keyType
+
+			leaf, err := GenerateLeaf(ca, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := leaf.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+				t.Fatalf("leaf doesn't verify against the RSA CA, %v", err)
+			}
+
+			want := keyType == KeyTypeRSA
+			if got := leaf.Cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0; got != want {
+				t.Fatalf("KeyEncipherment is %t, want %t", got, want)
+			}
+			if leaf.Cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+				t.Fatal("DigitalSignature is missing")
+			}
+
+			tpl, err := LeafTemplate(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tpl.KeyUsage != leaf.Cert.KeyUsage {
+				t.Fatalf("template key usage %v differs from the issued %v", tpl.KeyUsage, leaf.Cert.KeyUsage)
+			}
+		})
+	}
+
+	t.Run("csr", func(t *testing.T) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"web.local.dev"}}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := DefaultOptions()
+		cert, err := SignCSR(ca, csr, &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Fatal("Ed25519 leaf from a request claims KeyEncipherment")
+		}
+	})
+}
+
+func TestSignCSRValidatesNames(t *testing.T) {
+	ca, _ := newTestChain(t)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  x509.CertificateRequest
+	}{
+		{"hostname", x509.CertificateRequest{DNSNames: []string{"web_1.local.dev"}}},
+		{"email", x509.CertificateRequest{EmailAddresses: []string{"ops"}}},
+		{"uri", x509.CertificateRequest{URIs: []*url.URL{{Path: "relative/id"}}}},
+		{"long cn", x509.CertificateRequest{Subject: pkix.Name{CommonName: strings.Repeat("a", maxCommonNameLength+1)}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			der, err := x509.CreateCertificateRequest(rand.Reader, &tc.req, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			csr, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := DefaultOptions()
+			if _, err := SignCSR(ca, csr, &opts); err == nil {
+				t.Fatal("invalid request was signed")
+			}
+
+			opts.AllowInvalidSAN, opts.AllowLongCN = true, true
+			if _, err := SignCSR(ca, csr, &opts); err != nil {
+				t.Fatalf("not signed with the checks turned off, %v", err)
+			}
+		})
+	}
+}
+
+func TestSignLeafCAExpiry(t *testing.T) {
+	ca, _ := newTestChain(t)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		offset time.Duration
+		valid  bool
+	}{
+		{"before", -time.Second, true},
+		{"equal", 0, true},
+		{"after", time.Second, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tpl, err := LeafTemplate(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tpl.NotAfter = ca.Cert.NotAfter.Add(tc.offset)
+
+			_, err = signLeaf(ca, tpl, pub, &opts)
+			if tc.valid && err != nil {
+				t.Fatalf("leaf expiring %s the CA was rejected, %v", tc.name, err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("leaf outliving its CA was signed")
+			}
+		})
+	}
+}
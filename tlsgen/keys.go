@@ -0,0 +1,152 @@
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+)
+
+// ParsePrivateKey parses a DER encoded PKCS#1, PKCS#8 or SEC 1 private key.
+func ParsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported or malformed private key")
+}
+
+// KeyMatches reports whether key is the private half of pub.
+func KeyMatches(key crypto.Signer, pub crypto.PublicKey) bool {
+	k, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(pub)
+}
+
+// Supported values of Options.KeyType.
+const (
+	KeyTypeRSA       = "rsa"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeECDSAP384 = "ecdsa-p384"
+	KeyTypeEd25519   = "ed25519"
+)
+
+// Supported encodings of RSA private keys, see MarshalPrivateKeyAs. Other
+// key types are always PKCS#8.
+const (
+	KeyFormatPKCS1 = "pkcs1"
+	KeyFormatPKCS8 = "pkcs8"
+)
+
+// DefaultRSABits is the size of RSA keys.
+const DefaultRSABits = 2048
+
+var (
+	// KeyTypes lists the supported key types.
+	KeyTypes = []string{KeyTypeRSA, KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519}
+	// KeyFormats lists the supported private key encodings.
+	KeyFormats = []string{KeyFormatPKCS1, KeyFormatPKCS8}
+	// RSASizes lists the supported RSA key sizes.
+	RSASizes = []int{2048, 3072, 4096}
+)
+
+// generateKey creates the private key for the certificate identified by
+// label, reproducibly when a seed is configured.
+func generateKey(opts *Options, label string) (crypto.Signer, error) {
+	r := rand.Reader
+	if opts.Seed != nil {
+		r = opts.random(label + "/key")
+	}
+
+	switch opts.KeyType {
+	case KeyTypeECDSAP256, KeyTypeECDSAP384:
+		curve := elliptic.P256()
+		if opts.KeyType == KeyTypeECDSAP384 {
+			curve = elliptic.P384()
+		}
+
+		if opts.Seed != nil {
+			return seededECDSAKey(r, curve)
+		}
+		return ecdsa.GenerateKey(curve, r)
+	case KeyTypeEd25519:
+		// reads exactly one seed, which keeps it reproducible as is
+		_, key, err := ed25519.GenerateKey(r)
+		return key, err
+	}
+
+	if opts.Seed != nil {
+		return seededRSAKey(r, opts.RSABits)
+	}
+
+	return rsa.GenerateKey(r, opts.RSABits)
+}
+
+// SignatureAlgorithm returns the algorithm certificates signed by a key
+// with the public half pub use.
+func SignatureAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P384() {
+			return x509.ECDSAWithSHA384
+		}
+		return x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	}
+
+	return x509.SHA256WithRSA
+}
+
+// leafKeyUsage returns usage for a leaf certifying pub. KeyEncipherment is
+// only kept for RSA keys, ECDSA and Ed25519 keys can sign but not encipher.
+func leafKeyUsage(usage x509.KeyUsage, pub crypto.PublicKey) x509.KeyUsage {
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		usage &^= x509.KeyUsageKeyEncipherment
+	}
+
+	return usage
+}
+
+// MarshalPrivateKey returns the PEM block for key: PKCS#1 for RSA, to stay
+// compatible with existing consumers, and PKCS#8 for every other type.
+func MarshalPrivateKey(key crypto.PrivateKey) (*pem.Block, error) {
+	return MarshalPrivateKeyAs(key, KeyFormatPKCS1)
+}
+
+// MarshalPrivateKeyAs is MarshalPrivateKey with the RSA encoding chosen by
+// format, KeyFormatPKCS8 gives the generic "PRIVATE KEY" block many newer
+// consumers, such as cert-manager, prefer.
+func MarshalPrivateKeyAs(key crypto.PrivateKey, format string) (*pem.Block, error) {
+	if !slices.Contains(KeyFormats, format) {
+		return nil, fmt.Errorf("unknown key format %q, must be %s or %s", format, KeyFormatPKCS1, KeyFormatPKCS8)
+	}
+
+	if k, ok := key.(*rsa.PrivateKey); ok && format == KeyFormatPKCS1 {
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal private key, %w", err)
+	}
+
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
@@ -0,0 +1,189 @@
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// OCSP certificate statuses, see CreateOCSPResponse.
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+)
+
+// OCSPStatuses are the statuses CreateOCSPResponse accepts.
+var OCSPStatuses = []string{OCSPGood, OCSPRevoked, OCSPUnknown}
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// ocspSigners maps the algorithms SignatureAlgorithm picks to their
+// identifier and digest, Ed25519 signs the message itself.
+var ocspSigners = map[x509.SignatureAlgorithm]struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	x509.SHA256WithRSA:   {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	x509.ECDSAWithSHA256: {asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, crypto.SHA256},
+	x509.ECDSAWithSHA384: {asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, crypto.SHA384},
+	x509.PureEd25519:     {asn1.ObjectIdentifier{1, 3, 101, 112}, 0},
+}
+
+// The RFC 6960 structures, as far as they're needed for writing. The OCSP
+// module uses explicit tagging, except for the CertStatus choice.
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicOCSPResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type ocspResponseData struct {
+	ResponderKeyHash []byte    `asn1:"explicit,tag:2"`
+	ProducedAt       time.Time `asn1:"generalized"`
+	Responses        []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	KeyHash       []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time `asn1:"generalized"`
+}
+
+// CreateOCSPResponse returns a DER encoded OCSP response for leaf with the
+// given status, signed by its issuer ca directly, without a delegated
+// responder. It's valid for Options.CRLTTL, like a CRL, and suits stapling,
+// e.g. with tls.Certificate OCSPStaple or nginx ssl_stapling_file.
+func CreateOCSPResponse(ca *CertBundle, leaf *x509.Certificate, status string, opts *Options) ([]byte, error) {
+	if err := leaf.CheckSignatureFrom(ca.Cert); err != nil {
+		return nil, fmt.Errorf("%s wasn't issued by %s, %w", leaf.Subject, ca.Cert.Subject, err)
+	}
+
+	if err := CheckCAValidity(ca.Cert, time.Now()); err != nil {
+		return nil, fmt.Errorf("can't sign an OCSP response with %s, %w, regenerate it", ca.Cert.Subject, err)
+	}
+
+	signer, ok := ocspSigners[SignatureAlgorithm(ca.Key.Public())]
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", ca.Key.Public())
+	}
+
+	keyHash, err := publicKeyHash(ca.Cert)
+	if err != nil {
+		return nil, err
+	}
+
+	// second precision, GeneralizedTime must not carry fractions here
+	now := opts.now().UTC().Truncate(time.Second)
+	nameHash := sha1.Sum(leaf.RawIssuer)
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+			NameHash:      nameHash[:],
+			KeyHash:       keyHash,
+			SerialNumber:  leaf.SerialNumber,
+		},
+		ThisUpdate: now,
+		NextUpdate: now.Add(opts.CRLTTL),
+	}
+
+	switch status {
+	case OCSPGood:
+		single.Good = true
+	case OCSPRevoked:
+		single.Revoked = ocspRevokedInfo{RevocationTime: now}
+	case OCSPUnknown:
+		single.Unknown = true
+	default:
+		return nil, fmt.Errorf("unknown OCSP status %q, must be %s, %s or %s", status, OCSPGood, OCSPRevoked, OCSPUnknown)
+	}
+
+	tbs, err := asn1.Marshal(ocspResponseData{
+		ResponderKeyHash: keyHash,
+		ProducedAt:       now,
+		Responses:        []ocspSingleResponse{single},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := tbs
+	if signer.hash != 0 {
+		h := signer.hash.New()
+		h.Write(tbs)
+		digest = h.Sum(nil)
+	}
+
+	signature, err := ca.Key.Sign(rand.Reader, digest, signer.hash)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign OCSP response, %w", err)
+	}
+
+	alg := pkix.AlgorithmIdentifier{Algorithm: signer.oid}
+	if signer.oid.Equal(ocspSigners[x509.SHA256WithRSA].oid) {
+		// RSA signature algorithms carry explicit NULL parameters
+		alg.Parameters = asn1.NullRawValue
+	}
+
+	basic, err := asn1.Marshal(basicOCSPResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: alg,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspResponse{
+		Status:   0, // successful
+		Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic},
+	})
+}
+
+// publicKeyHash returns the SHA-1 hash of the subjectPublicKey bits of cert,
+// which identifies the issuer and responder key in OCSP.
+func publicKeyHash(cert *x509.Certificate) ([]byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, fmt.Errorf("couldn't parse the public key of %s, %w", cert.Subject, err)
+	}
+
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:], nil
+}
@@ -0,0 +1,73 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestCreateOCSPResponseRoundTrip(t *testing.T) {
+	ca, leaf := newTestChain(t)
+	opts := DefaultOptions()
+
+	for _, status := range OCSPStatuses {
+		t.Run(status, func(t *testing.T) {
+			der, err := CreateOCSPResponse(ca, leaf.Cert, status, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var resp ocspResponse
+			if _, err := asn1.Unmarshal(der, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != 0 || !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+				t.Fatalf("got status %d and type %s, want a successful basic response", resp.Status, resp.Response.ResponseType)
+			}
+
+			var basic basicOCSPResponse
+			if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+				t.Fatal(err)
+			}
+			if err := ca.Cert.CheckSignature(x509.ECDSAWithSHA256, basic.TBSResponseData.FullBytes, basic.Signature.Bytes); err != nil {
+				t.Fatalf("signature doesn't verify with the CA, %v", err)
+			}
+
+			var data ocspResponseData
+			if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+				t.Fatal(err)
+			}
+			if len(data.Responses) != 1 {
+				t.Fatalf("got %d responses, want 1", len(data.Responses))
+			}
+
+			single := data.Responses[0]
+			if single.CertID.SerialNumber.Cmp(leaf.Cert.SerialNumber) != 0 {
+				t.Fatalf("got serial %x, want %x", single.CertID.SerialNumber, leaf.Cert.SerialNumber)
+			}
+			if got := single.NextUpdate.Sub(single.ThisUpdate); got != opts.CRLTTL {
+				t.Fatalf("response is valid for %s, want %s", got, opts.CRLTTL)
+			}
+
+			got := map[string]bool{
+				OCSPGood:    bool(single.Good),
+				OCSPRevoked: !single.Revoked.RevocationTime.IsZero(),
+				OCSPUnknown: bool(single.Unknown),
+			}
+			for s, set := range got {
+				if set != (s == status) {
+					t.Fatalf("%s is %t for a %s response", s, set, status)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOCSPResponseUnknownStatus(t *testing.T) {
+	ca, leaf := newTestChain(t)
+	opts := DefaultOptions()
+
+	if _, err := CreateOCSPResponse(ca, leaf.Cert, "expired", &opts); err == nil {
+		t.Fatal("unknown status was accepted")
+	}
+}
@@ -0,0 +1,334 @@
+// Package tlsgen issues development CA and leaf certificates entirely in
+// memory. The tlsgen-dev CLI is a wrapper around it that adds the file
+// layout under its output directory.
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultOrganization is the subject organization of issued certificates.
+	DefaultOrganization = "My Dev org"
+	// DefaultLeafTTL is the validity of leaf certificates.
+	DefaultLeafTTL = time.Hour * 4
+	// DefaultCATTL is the validity of CA certificates.
+	DefaultCATTL = time.Hour * 24 * 365 * 10 // 10 years
+	// DefaultBackdate is how far NotBefore is moved into the past.
+	DefaultBackdate = time.Minute * 5
+	// DefaultSPIFFEDomain is the trust domain of leaf SPIFFE IDs.
+	DefaultSPIFFEDomain = "local.dev"
+	// DefaultSerialBits is the bit length of random serial numbers.
+	DefaultSerialBits = 128
+	// DefaultCRLTTL is how long a generated CRL is valid, until NextUpdate.
+	DefaultCRLTTL = time.Hour * 24 * 7
+
+	// UsageBoth, UsageServer and UsageClient select the extended key usage
+	// of leaves without a profile.
+	UsageBoth   = "both"
+	UsageServer = "server"
+	UsageClient = "client"
+
+	// AKIModeKeyID references the issuing CA by its key id.
+	AKIModeKeyID = "keyid"
+	// AKIModeIssuerSerial references the issuing CA by issuer DN and serial.
+	AKIModeIssuerSerial = "issuer-serial"
+
+	// MinSerialBits and MaxSerialBits bound Options.SerialBits.
+	MinSerialBits = 64
+	MaxSerialBits = 159 // RFC 5280 caps serials at 20 octets
+
+	maxCommonNameLength = 64 // ub-common-name, some validators reject longer
+)
+
+// NoExpiryNotAfter is the RFC 5280 "no well-defined expiration date" value.
+var NoExpiryNotAfter = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+
+// TemplateFunc customizes a certificate template after it has been built from
+// the options, right before it gets signed. It's the escape hatch for fields
+// that aren't covered by a dedicated option.
+type TemplateFunc func(*x509.Certificate)
+
+// Options configures the certificates issued by this package. Start from
+// DefaultOptions, the zero value isn't usable. The CLI flag of each field is
+// named in the errors Validate returns.
+type Options struct {
+	KeyType string
+	RSABits int
+	// Seed makes keys, serials and signatures reproducible, never use it for
+	// production. Validity still starts at the current time unless StartTime
+	// is set, and ECDSA signatures stay randomized.
+	Seed       []byte
+	SerialBits int
+	// Serial is used as is instead of a random serial number when set
+	Serial *big.Int
+
+	LeafTTL        time.Duration
+	CATTL          time.Duration
+	Backdate       time.Duration
+	ValidityJitter time.Duration
+	NoExpiry       bool
+	AlignUTCDay    bool
+	// StartTime replaces the current time validity starts at, e.g. to
+	// reproduce a certificate
+	StartTime time.Time
+	// NotBefore and NotAfter, when set, replace the respective end of the
+	// validity computed from the TTLs, e.g. for expired test fixtures
+	NotBefore time.Time
+	NotAfter  time.Time
+	CRLTTL    time.Duration
+
+	Organization string
+	CommonName   string
+	CNFromSPIFFE bool
+	AllowLongCN  bool
+	// SubjectDER replaces the leaf subject with this DER encoded name
+	SubjectDER []byte
+
+	DNSNames        []string
+	IPAddresses     []net.IP
+	IPCIDRs         []string
+	Emails          []string
+	URIs            []string
+	AllowInvalidSAN bool
+
+	SPIFFE       bool
+	SPIFFEDomain string
+	// SPIFFEID is the workload path of the leaf SPIFFE ID, the hostname when empty
+	SPIFFEID     string
+	K8sNamespace string
+	K8sSA        string
+
+	Profile string
+	// Usage is UsageBoth, UsageServer or UsageClient, profiles set their own
+	Usage    string
+	DBUser   string
+	DeviceID string
+
+	// PermittedDNSDomains, ExcludedDNSDomains and PermittedURIDomains are
+	// the name constraints of a generated CA
+	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
+	PermittedURIDomains []string
+
+	// CRLURLs and OCSPURLs are the CRL distribution points and OCSP
+	// responders generated leaves advertise
+	CRLURLs    []string
+	OCSPURLs   []string
+	MustStaple bool
+	// CASKI is the Subject Key Identifier of a generated root CA
+	CASKI   []byte
+	AKIMode string
+	// AKI is the Authority Key Identifier key id of generated leaves
+	AKI  []byte
+	FIPS bool
+
+	TemplateFunc TemplateFunc
+	// LeafKey is an existing key to certify instead of generating one
+	LeafKey crypto.Signer
+	// Renew is an existing leaf whose subject and SANs are reissued as is
+	Renew *x509.Certificate
+	// Index of the leaf within a bulk run, 0 outside of one
+	Index int
+}
+
+// DefaultOptions returns Options with every setting at its default value.
+func DefaultOptions() Options {
+	return Options{
+		KeyType:      KeyTypeRSA,
+		RSABits:      DefaultRSABits,
+		SerialBits:   DefaultSerialBits,
+		LeafTTL:      DefaultLeafTTL,
+		CATTL:        DefaultCATTL,
+		CRLTTL:       DefaultCRLTTL,
+		Backdate:     DefaultBackdate,
+		Organization: DefaultOrganization,
+		SPIFFE:       true,
+		SPIFFEDomain: DefaultSPIFFEDomain,
+		AKIMode:      AKIModeKeyID,
+		Usage:        UsageBoth,
+	}
+}
+
+// Validate rejects option combinations that would produce a broken certificate.
+func (o *Options) Validate() error {
+	if !slices.Contains(KeyTypes, o.KeyType) {
+		return fmt.Errorf("unknown -key-type %q, must be one of: %s", o.KeyType, strings.Join(KeyTypes, ", "))
+	}
+
+	if !slices.Contains(RSASizes, o.RSABits) {
+		return fmt.Errorf("-rsa-bits must be 2048, 3072 or 4096, got %d", o.RSABits)
+	}
+
+	switch o.AKIMode {
+	case AKIModeKeyID, AKIModeIssuerSerial:
+	default:
+		return fmt.Errorf("unsupported -aki-mode %q, must be %q or %q", o.AKIMode, AKIModeKeyID, AKIModeIssuerSerial)
+	}
+
+	switch o.Usage {
+	case UsageBoth, UsageServer, UsageClient:
+	default:
+		return fmt.Errorf("unknown -usage %q, must be %s, %s or %s", o.Usage, UsageServer, UsageClient, UsageBoth)
+	}
+
+	if o.Usage != UsageBoth && o.Profile != "" {
+		return fmt.Errorf("-usage can't be combined with -profile, the profile sets the key usage")
+	}
+
+	if o.SerialBits < MinSerialBits || o.SerialBits > MaxSerialBits {
+		return fmt.Errorf("-serial-bits must be between %d and %d, got %d", MinSerialBits, MaxSerialBits, o.SerialBits)
+	}
+
+	if o.Serial != nil && (o.Serial.Sign() <= 0 || o.Serial.BitLen() > MaxSerialBits) {
+		return fmt.Errorf("-serial must be positive and fit into %d bits", MaxSerialBits)
+	}
+
+	if (o.K8sNamespace == "") != (o.K8sSA == "") {
+		return fmt.Errorf("-k8s-namespace and -k8s-sa must be set together")
+	}
+
+	for _, v := range []string{o.K8sNamespace, o.K8sSA} {
+		if strings.Contains(v, "/") {
+			return fmt.Errorf("kubernetes identity segment %q must not contain '/'", v)
+		}
+	}
+
+	for _, cidr := range o.IPCIDRs {
+		if _, err := expandCIDR(cidr); err != nil {
+			return err
+		}
+	}
+
+	if err := validateProfile(o); err != nil {
+		return err
+	}
+
+	if o.AKI != nil && o.AKIMode == AKIModeIssuerSerial {
+		return fmt.Errorf("-aki sets a key id and can't be combined with -aki-mode %s", AKIModeIssuerSerial)
+	}
+
+	if o.Organization == "" {
+		return fmt.Errorf("-org can't be empty")
+	}
+
+	if o.SubjectDER != nil && (o.CommonName != "" || o.CNFromSPIFFE) {
+		return fmt.Errorf("-subject-der can't be combined with -cn or -cn-from-spiffe")
+	}
+
+	if o.LeafTTL <= 0 || o.CATTL <= 0 {
+		return fmt.Errorf("-leaf-ttl and -ca-ttl must be positive durations")
+	}
+
+	if o.CRLTTL <= 0 {
+		return fmt.Errorf("-crl-ttl must be a positive duration")
+	}
+
+	for _, v := range o.CRLURLs {
+		if !isAbsoluteURL(v) {
+			return fmt.Errorf("-crl-url %q must be an absolute URL, e.g. http://localhost:8080/root.crl", v)
+		}
+	}
+
+	for _, v := range o.OCSPURLs {
+		if !isAbsoluteURL(v) {
+			return fmt.Errorf("-ocsp-url %q must be an absolute URL, e.g. http://localhost:8080/ocsp", v)
+		}
+	}
+
+	if o.Backdate < 0 {
+		return fmt.Errorf("-backdate must not be negative")
+	}
+
+	if o.ValidityJitter < 0 || o.ValidityJitter >= o.LeafTTL {
+		return fmt.Errorf("-validity-jitter must be between 0 and the leaf lifetime of %s", o.LeafTTL)
+	}
+
+	if o.ValidityJitter > 0 && o.NoExpiry {
+		return fmt.Errorf("-validity-jitter can't be combined with -no-expiry")
+	}
+
+	if !o.NotAfter.IsZero() && (o.NoExpiry || o.ValidityJitter > 0) {
+		return fmt.Errorf("-not-after can't be combined with -no-expiry or -validity-jitter")
+	}
+
+	if (!o.NotBefore.IsZero() || !o.NotAfter.IsZero()) && o.AlignUTCDay {
+		return fmt.Errorf("-not-before and -not-after can't be combined with -align-utc-day")
+	}
+
+	if !o.NotBefore.IsZero() && !o.NotAfter.IsZero() && !o.NotAfter.After(o.NotBefore) {
+		return fmt.Errorf("-not-after must be later than -not-before")
+	}
+
+	if o.SPIFFE && o.SPIFFEDomain == "" {
+		return fmt.Errorf("-spiffe-domain can't be empty, use -spiffe=false to leave the SPIFFE ID out")
+	}
+
+	if o.SPIFFE || o.CNFromSPIFFE {
+		if err := validateTrustDomain(o.SPIFFEDomain); err != nil {
+			return fmt.Errorf("-spiffe-domain: %w", err)
+		}
+
+		paths := []struct{ flag, v string }{{"-spiffe-id", o.SPIFFEID}, {"-k8s-namespace", o.K8sNamespace}, {"-k8s-sa", o.K8sSA}}
+		for _, p := range paths {
+			if p.v == "" {
+				continue
+			}
+			if err := ValidateSPIFFEPath(p.v); err != nil {
+				return fmt.Errorf("%s: %w", p.flag, err)
+			}
+		}
+	}
+
+	if o.SPIFFEID != "" && o.K8sNamespace != "" {
+		return fmt.Errorf("-spiffe-id can't be combined with -k8s-namespace and -k8s-sa, they set the workload path")
+	}
+
+	if o.CNFromSPIFFE {
+		if !o.SPIFFE {
+			return fmt.Errorf("-cn-from-spiffe requires the SPIFFE ID, drop -spiffe=false")
+		}
+		if o.CommonName != "" {
+			return fmt.Errorf("-cn and -cn-from-spiffe are mutually exclusive")
+		}
+		if certProfiles[o.Profile].noSPIFFE {
+			return fmt.Errorf("-cn-from-spiffe can't be used with -profile %s, it has no SPIFFE ID", o.Profile)
+		}
+	}
+
+	if o.AllowInvalidSAN {
+		return nil
+	}
+
+	constraints := []struct {
+		flag    string
+		domains []string
+	}{
+		{"-permitted-dns", o.PermittedDNSDomains},
+		{"-excluded-dns", o.ExcludedDNSDomains},
+		{"-permitted-uri", o.PermittedURIDomains},
+	}
+	for _, c := range constraints {
+		for _, domain := range c.domains {
+			if err := validateConstraintDomain(c.flag, domain); err != nil {
+				return err
+			}
+		}
+	}
+
+	return validateSANs(o.DNSNames, o.Emails, o.URIs)
+}
+
+// isAbsoluteURL reports whether v is a URL with scheme and host.
+func isAbsoluteURL(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,59 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultDir is where the CLI reads and writes its material by default.
+const DefaultDir = "/tmp/tls"
+
+// File locations relative to the CLI output directory.
+const (
+	RootCertFile = "ca/root.pem"
+	RootKeyFile  = "ca/root.key"
+	LeafCertFile = "client/client.pem"
+	LeafKeyFile  = "client/client-key.pem"
+)
+
+// Paths are the locations of the generated certificates and keys.
+type Paths struct {
+	RootCert string
+	RootKey  string
+	LeafCert string
+	LeafKey  string
+}
+
+// DefaultPaths returns the locations the CLI writes to below dir.
+func DefaultPaths(dir string) Paths {
+	return Paths{
+		RootCert: filepath.Join(dir, RootCertFile),
+		RootKey:  filepath.Join(dir, RootKeyFile),
+		LeafCert: filepath.Join(dir, LeafCertFile),
+		LeafKey:  filepath.Join(dir, LeafKeyFile),
+	}
+}
+
+// CACertPool returns a pool holding the root CA at paths.RootCert, ready to
+// be used as tls.Config RootCAs or ClientCAs.
+func CACertPool(paths Paths) (*x509.CertPool, error) {
+	return LoadCertPool(paths.RootCert)
+}
+
+// LoadCertPool returns a pool holding every certificate of the PEM file at
+// path.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read CA certificate, %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", path)
+	}
+
+	return pool, nil
+}
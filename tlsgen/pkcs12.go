@@ -0,0 +1,299 @@
+package tlsgen
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"unicode/utf16"
+)
+
+var (
+	oidDataContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// pkcs12MACIterations is the work factor of the integrity MAC, the OpenSSL
+// default.
+const pkcs12MACIterations = 2048
+
+// The RFC 7292 structures, as far as they're needed for writing.
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+// EncodePKCS12 returns a PKCS#12 archive holding key and certs, the first
+// of which belongs to key, for Windows and Java consumers. The key is
+// shrouded with PBES2 (PBKDF2-HMAC-SHA256, AES-256-CBC) and the archive is
+// protected by an HMAC-SHA256, both using password, the certificates are
+// stored in the clear, like OpenSSL does with -certpbe NONE. friendlyName
+// labels the key and its certificate.
+func EncodePKCS12(key crypto.Signer, certs [][]byte, password, friendlyName string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates given")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal private key, %w", err)
+	}
+
+	shrouded, err := encryptPKCS8(der, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encrypt private key, %w", err)
+	}
+
+	// ties the key to its certificate
+	keyID := sha256.Sum256(certs[0])
+	attrs, err := pkcs12Attributes(keyID[:], friendlyName)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBag := newSafeBag(oidPKCS8ShroudedKeyBag, shrouded, attrs)
+
+	var certBags []safeBag
+	for i, cert := range certs {
+		data, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: cert})
+		if err != nil {
+			return nil, err
+		}
+
+		var bagAttrs []pkcs12Attribute
+		if i == 0 {
+			bagAttrs = attrs
+		}
+
+		certBags = append(certBags, newSafeBag(oidCertBag, data, bagAttrs))
+	}
+
+	var authSafe []contentInfo
+	for _, bags := range [][]safeBag{certBags, {keyBag}} {
+		info, err := dataContentInfo(bags)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, info)
+	}
+
+	authSafeDER, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := pkcs12MAC(authSafeDER, password)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := explicitOctetString(authSafeDER)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidDataContentType, Content: content},
+		MacData:  mac,
+	})
+}
+
+// dataContentInfo wraps bags into an unencrypted data ContentInfo.
+func dataContentInfo(bags []safeBag) (contentInfo, error) {
+	der, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, err
+	}
+
+	content, err := explicitOctetString(der)
+	if err != nil {
+		return contentInfo{}, err
+	}
+
+	return contentInfo{ContentType: oidDataContentType, Content: content}, nil
+}
+
+// explicitOctetString returns data as [0] EXPLICIT OCTET STRING. The asn1
+// package ignores struct tags on RawValue fields, so the tag is built here.
+func explicitOctetString(data []byte) (asn1.RawValue, error) {
+	octets, err := asn1.Marshal(data)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}, nil
+}
+
+// newSafeBag returns a SafeBag of type id with the DER value der.
+func newSafeBag(id asn1.ObjectIdentifier, der []byte, attrs []pkcs12Attribute) safeBag {
+	return safeBag{
+		ID:         id,
+		Value:      asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+		Attributes: attrs,
+	}
+}
+
+// pkcs12Attributes returns the localKeyId and, when set, friendlyName bag
+// attributes.
+func pkcs12Attributes(keyID []byte, friendlyName string) ([]pkcs12Attribute, error) {
+	id, err := asn1.Marshal(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []pkcs12Attribute{{
+		ID:    oidLocalKeyID,
+		Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: id},
+	}}
+
+	if friendlyName != "" {
+		name := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagBMPString, Bytes: bmpString(friendlyName, false)}
+		der, err := asn1.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, pkcs12Attribute{
+			ID:    oidFriendlyName,
+			Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: der},
+		})
+	}
+
+	return attrs, nil
+}
+
+// pkcs12MAC computes the integrity MAC over the AuthenticatedSafe DER.
+func pkcs12MAC(authSafe []byte, password string) (macData, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return macData{}, err
+	}
+
+	key := pkcs12KDF(bmpString(password, true), salt, pkcs12MACIterations, 3, sha256.Size)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(authSafe)
+
+	return macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			Digest:    mac.Sum(nil),
+		},
+		MacSalt:    salt,
+		Iterations: pkcs12MACIterations,
+	}, nil
+}
+
+// pkcs12KDF is the RFC 7292 appendix B key derivation with SHA-256. id
+// selects the purpose, 3 derives MAC keys.
+func pkcs12KDF(password, salt []byte, iterations int, id byte, size int) []byte {
+	const u, v = sha256.Size, 64
+
+	// fill repeats b up to the next multiple of v bytes
+	fill := func(b []byte) []byte {
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+
+	var i []byte
+	if len(salt) > 0 {
+		i = append(i, fill(salt)...)
+	}
+	if len(password) > 0 {
+		i = append(i, fill(password)...)
+	}
+
+	one := big.NewInt(1)
+	var out []byte
+	for len(out) < size {
+		h := sha256.New()
+		h.Write(d)
+		h.Write(i)
+		a := h.Sum(nil)
+		for n := 1; n < iterations; n++ {
+			sum := sha256.Sum256(a)
+			a = sum[:]
+		}
+		out = append(out, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(v*8) for every v byte block of I
+		b := new(big.Int).SetBytes(fill(a[:u]))
+		for j := 0; j < len(i); j += v {
+			block := new(big.Int).SetBytes(i[j : j+v])
+			block.Add(block, b)
+			block.Add(block, one)
+			raw := block.Bytes()
+			if len(raw) > v {
+				raw = raw[len(raw)-v:]
+			}
+			copy(i[j:j+v], make([]byte, v))
+			copy(i[j+v-len(raw):j+v], raw)
+		}
+	}
+
+	return out[:size]
+}
+
+// bmpString encodes s as big endian UTF-16, with the two byte terminator
+// PKCS#12 passwords carry when terminate is set.
+func bmpString(s string, terminate bool) []byte {
+	var out []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(c>>8), byte(c))
+	}
+	if terminate {
+		out = append(out, 0, 0)
+	}
+
+	return out
+}
@@ -0,0 +1,107 @@
+package tlsgen
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestEncodePKCS12RoundTrip(t *testing.T) {
+	ca, leaf := newTestChain(t)
+	chain := [][]byte{leaf.Cert.Raw, ca.Cert.Raw}
+	const password = "secret"
+
+	der, err := EncodePKCS12(leaf.Key, chain, password, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(der, &pfx); err != nil || len(rest) > 0 {
+		t.Fatalf("couldn't parse PFX, %v (%d trailing bytes)", err, len(rest))
+	}
+	if pfx.Version != 3 {
+		t.Fatalf("got version %d, want 3", pfx.Version)
+	}
+
+	authSafeDER := unwrapOctetString(t, pfx.AuthSafe)
+
+	key := pkcs12KDF(bmpString(password, true), pfx.MacData.MacSalt, pfx.MacData.Iterations, 3, sha256.Size)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(authSafeDER)
+	if !hmac.Equal(mac.Sum(nil), pfx.MacData.Mac.Digest) {
+		t.Fatal("MAC doesn't verify with the password")
+	}
+
+	var authSafe []contentInfo
+	if _, err := asn1.Unmarshal(authSafeDER, &authSafe); err != nil {
+		t.Fatal(err)
+	}
+
+	var certs [][]byte
+	var keyBags int
+	for _, info := range authSafe {
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(unwrapOctetString(t, info), &bags); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cert certBag
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cert); err != nil {
+					t.Fatal(err)
+				}
+				certs = append(certs, cert.Data)
+			case bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				keyBags++
+				plain, err := decryptPKCS8(bag.Value.Bytes, []byte(password))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := ParsePrivateKey(plain)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !KeyMatches(got, leaf.Cert.PublicKey) {
+					t.Fatal("key bag doesn't hold the leaf key")
+				}
+			default:
+				t.Fatalf("unexpected bag type %s", bag.ID)
+			}
+		}
+	}
+
+	if keyBags != 1 {
+		t.Fatalf("got %d key bags, want 1", keyBags)
+	}
+	if len(certs) != len(chain) {
+		t.Fatalf("got %d certificates, want %d", len(certs), len(chain))
+	}
+	for i := range chain {
+		if !bytes.Equal(certs[i], chain[i]) {
+			t.Fatalf("certificate %d differs from the chain", i)
+		}
+	}
+}
+
+// unwrapOctetString returns the data of a ContentInfo, an [0] EXPLICIT OCTET
+// STRING.
+func unwrapOctetString(t *testing.T, info contentInfo) []byte {
+	t.Helper()
+
+	if !info.ContentType.Equal(oidDataContentType) {
+		t.Fatalf("got content type %s, want data", info.ContentType)
+	}
+
+	var data []byte
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
@@ -0,0 +1,296 @@
+package tlsgen
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// errIncorrectPassword is returned when an encrypted key can't be decrypted
+// with the supplied password.
+var errIncorrectPassword = errors.New("decryption failed, the password is probably incorrect")
+
+// encryptedPrivateKeyInfo is the RFC 5208 EncryptedPrivateKeyInfo structure.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the RFC 8018 PBES2-params.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the RFC 8018 PBKDF2-params.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// DecryptKeyBlock returns an unencrypted PEM block for block. Both PKCS#8
+// "ENCRYPTED PRIVATE KEY" (PBES2) and legacy DEK-Info encrypted blocks are
+// supported. Unencrypted blocks are returned as they are.
+func DecryptKeyBlock(block *pem.Block, password string) (*pem.Block, error) {
+	legacy := block.Headers["DEK-Info"] != ""
+	if block.Type != "ENCRYPTED PRIVATE KEY" && !legacy {
+		return block, nil
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("private key is encrypted but no password was supplied")
+	}
+
+	if legacy {
+		// deprecated, but reading legacy keys is still useful; we never write them
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decrypt private key, %w", err)
+		}
+
+		return &pem.Block{Type: block.Type, Bytes: der}, nil
+	}
+
+	der, err := decryptPKCS8(block.Bytes, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt private key, %w", err)
+	}
+
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+// decryptPKCS8 decrypts a PBES2 encrypted PKCS#8 structure using PBKDF2 and
+// AES-CBC or 3DES-CBC, returning the plain PKCS#8 DER.
+func decryptPKCS8(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("malformed encrypted private key, %w", err)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption scheme %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("malformed PBES2 parameters, %w", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("malformed PBKDF2 parameters, %w", err)
+	}
+
+	prf := sha1.New
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", kdf.PRF.Algorithm)
+	}
+
+	var (
+		keyLen   int
+		newBlock func([]byte) (cipher.Block, error)
+	)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newBlock = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newBlock = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newBlock = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLen, newBlock = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", scheme)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("malformed cipher parameters, %w", err)
+	}
+
+	c, err := newBlock(pbkdf2(prf, password, kdf.Salt, kdf.IterationCount, keyLen))
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(iv) != c.BlockSize() || len(data) == 0 || len(data)%c.BlockSize() != 0 {
+		return nil, fmt.Errorf("malformed encrypted data")
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(plain, data)
+
+	plain, err = unpad(plain, c.BlockSize())
+	if err != nil {
+		return nil, err
+	}
+
+	// a wrong password almost always yields garbage that isn't valid PKCS#8
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		return nil, errIncorrectPassword
+	}
+
+	return plain, nil
+}
+
+// unpad strips PKCS#7 padding.
+func unpad(data []byte, blockSize int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, errIncorrectPassword
+	}
+
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, errIncorrectPassword
+		}
+	}
+
+	return data[:len(data)-n], nil
+}
+
+// pbkdf2 implements RFC 8018 PBKDF2 key derivation.
+func pbkdf2(prf func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	mac := hmac.New(prf, password)
+	hashLen := mac.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for i := 1; i <= blocks; i++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+		t := mac.Sum(nil)
+		copy(u, t)
+
+		for n := 1; n < iterations; n++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+// pbkdf2Iterations is the PBKDF2 work factor of keys we encrypt.
+const pbkdf2Iterations = 100000
+
+// EncryptKeyBlock returns block as a PKCS#8 "ENCRYPTED PRIVATE KEY" block
+// using PBES2 with PBKDF2-HMAC-SHA256 and AES-256-CBC. With an empty password
+// block is returned as it is.
+func EncryptKeyBlock(block *pem.Block, password string) (*pem.Block, error) {
+	if password == "" {
+		return block, nil
+	}
+
+	der := block.Bytes
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse private key, %w", err)
+		}
+
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't marshal private key, %w", err)
+		}
+	}
+
+	encrypted, err := encryptPKCS8(der, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encrypt private key, %w", err)
+	}
+
+	return &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}, nil
+}
+
+// encryptPKCS8 encrypts the plain PKCS#8 DER der, the inverse of
+// decryptPKCS8.
+func encryptPKCS8(der, password []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := aes.NewCipher(pbkdf2(sha256.New, password, salt, pbkdf2Iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+
+	// PKCS#7 padding, always at least one byte
+	n := c.BlockSize() - len(der)%c.BlockSize()
+	data := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(data, data)
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+}
@@ -0,0 +1,61 @@
+package tlsgen
+
+import (
+	"encoding/pem"
+	"testing"
+)
+
+func TestEncryptKeyBlockRoundTrip(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.KeyType = keyType
+			key, err := GenerateKey(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			block, err := MarshalPrivateKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encrypted, err := EncryptKeyBlock(block, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encrypted.Type != "ENCRYPTED PRIVATE KEY" {
+				t.Fatalf("got block type %q, want ENCRYPTED PRIVATE KEY", encrypted.Type)
+			}
+
+			if _, err := DecryptKeyBlock(encrypted, "wrong"); err == nil {
+				t.Fatal("decrypting with the wrong password succeeded")
+			}
+
+			decrypted, err := DecryptKeyBlock(encrypted, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParsePrivateKey(decrypted.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !KeyMatches(got, key.Public()) {
+				t.Fatal("decrypted key doesn't match the original")
+			}
+		})
+	}
+}
+
+func TestEncryptKeyBlockEmptyPassword(t *testing.T) {
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}}
+
+	got, err := EncryptKeyBlock(block, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != block {
+		t.Fatal("block without a password wasn't returned as it is")
+	}
+}
@@ -0,0 +1,245 @@
+package tlsgen
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	profileUser      = "user"
+	profilePeer      = "peer"
+	profileDatabase  = "database"
+	profileIoT       = "iot-device"
+	profileVPNServer = "vpn-server"
+	profileVPNClient = "vpn-client"
+	profileGRPC      = "grpc"
+	profileSMIME     = "smime"
+)
+
+// certProfile shapes a leaf certificate for a specific use case, on top of
+// the template built from the regular options.
+type certProfile struct {
+	keyUsage    x509.KeyUsage
+	extKeyUsage []x509.ExtKeyUsage
+	// unknownExtKeyUsage holds EKUs Go has no constant for
+	unknownExtKeyUsage []asn1.ObjectIdentifier
+	extensions         []pkix.Extension
+	// noSPIFFE drops the SPIFFE URI SAN, identities of humans aren't workloads
+	noSPIFFE bool
+	// noSANs drops every subject alternative name, the CN is the identity
+	noSANs bool
+	// commonName, when set, derives the subject CN from the options
+	commonName func(*Options) string
+	// validate checks the options the profile depends on
+	validate func(*Options) error
+}
+
+// certProfiles list the key usage of an RSA leaf, KeyEncipherment is dropped
+// for other key types when signing.
+var certProfiles = map[string]certProfile{
+	// user certificates authenticate a person, e.g. to a VPN or web app
+	profileUser: {
+		keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		noSPIFFE:    true,
+		validate: func(o *Options) error {
+			if o.CommonName == "" || len(o.Emails) == 0 {
+				return fmt.Errorf("-profile %s requires -cn with the user's name and at least one -email", profileUser)
+			}
+			return nil
+		},
+	},
+	// peer certificates identify mesh sidecars acting as client and server
+	profilePeer: {
+		keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		validate: func(o *Options) error {
+			if len(o.DNSNames) == 0 {
+				return fmt.Errorf("-profile %s requires at least one -dns name", profilePeer)
+			}
+			if !o.SPIFFE {
+				return fmt.Errorf("-profile %s certificates are SPIFFE SVIDs, drop -spiffe=false", profilePeer)
+			}
+			if len(o.URIs) > 0 {
+				return fmt.Errorf("-profile %s certificates carry the SPIFFE ID as their only URI SAN, drop -uri", profilePeer)
+			}
+			return nil
+		},
+	},
+	// database certificates authenticate a client to Postgres or MySQL, which
+	// map the CN to the database user
+	profileDatabase: {
+		keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		noSANs:      true,
+		commonName:  func(o *Options) string { return o.DBUser },
+		validate: func(o *Options) error {
+			if o.DBUser == "" {
+				return fmt.Errorf("-profile %s requires -db-user", profileDatabase)
+			}
+			if o.CommonName != "" || o.CNFromSPIFFE {
+				return fmt.Errorf("-profile %s sets the CN from -db-user, drop -cn and -cn-from-spiffe", profileDatabase)
+			}
+			if len(o.DNSNames) > 0 || len(o.IPAddresses) > 0 || len(o.IPCIDRs) > 0 || len(o.Emails) > 0 || len(o.URIs) > 0 {
+				return fmt.Errorf("-profile %s certificates carry no SANs, drop -dns, -ip, -ip-cidr, -email and -uri", profileDatabase)
+			}
+			return nil
+		},
+	},
+	// iot-device certificates register a device with an IoT broker such as
+	// AWS IoT Core, which identifies it by the CN
+	profileIoT: {
+		keyUsage:    x509.KeyUsageDigitalSignature,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		noSPIFFE:    true,
+		commonName:  func(o *Options) string { return o.DeviceID },
+		validate: func(o *Options) error {
+			if o.DeviceID == "" {
+				return fmt.Errorf("-profile %s requires -device-id", profileIoT)
+			}
+			if o.CommonName != "" || o.CNFromSPIFFE {
+				return fmt.Errorf("-profile %s sets the CN from -device-id, drop -cn and -cn-from-spiffe", profileIoT)
+			}
+			return nil
+		},
+	},
+	// vpn-server certificates suit OpenVPN servers checked with
+	// --remote-cert-tls server or the legacy --ns-cert-type server, and
+	// strongSwan/IKEv2 gateways, which match the peer identity against a SAN
+	profileVPNServer: {
+		keyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		unknownExtKeyUsage: []asn1.ObjectIdentifier{oidExtKeyUsageIKEIntermediate},
+		extensions:         []pkix.Extension{nsCertTypeExtension(nsCertTypeServer)},
+		noSPIFFE:           true,
+		validate: func(o *Options) error {
+			if len(o.DNSNames) == 0 && len(o.IPAddresses) == 0 && len(o.IPCIDRs) == 0 {
+				return fmt.Errorf("-profile %s requires the gateway address as -dns, -ip or -ip-cidr SAN", profileVPNServer)
+			}
+			return nil
+		},
+	},
+	// vpn-client certificates suit OpenVPN clients, identified by the CN, and
+	// strongSwan road warriors
+	profileVPNClient: {
+		keyUsage:    x509.KeyUsageDigitalSignature,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		extensions:  []pkix.Extension{nsCertTypeExtension(nsCertTypeClient)},
+		noSPIFFE:    true,
+		validate: func(o *Options) error {
+			if o.CommonName == "" {
+				return fmt.Errorf("-profile %s requires -cn with the client name", profileVPNClient)
+			}
+			return nil
+		},
+	},
+	// grpc certificates serve and call gRPC services over mTLS with a SPIFFE
+	// identity; clients verify the :authority against the DNS SANs
+	profileGRPC: {
+		keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		validate: func(o *Options) error {
+			if len(o.DNSNames) == 0 {
+				return fmt.Errorf("-profile %s requires the service authority as -dns name", profileGRPC)
+			}
+			if !o.SPIFFE {
+				return fmt.Errorf("-profile %s identifies services by their SPIFFE ID, drop -spiffe=false", profileGRPC)
+			}
+			if o.KeyType == KeyTypeEd25519 {
+				return fmt.Errorf("-profile %s requires an RSA or ECDSA key, not every gRPC TLS stack accepts %s", profileGRPC, KeyTypeEd25519)
+			}
+			return nil
+		},
+	},
+	// smime certificates sign and encrypt email; clients match the email SAN
+	// against the sender address
+	profileSMIME: {
+		keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		noSPIFFE:    true,
+		commonName: func(o *Options) string {
+			if o.CommonName != "" {
+				return o.CommonName
+			}
+			return o.Emails[0]
+		},
+		validate: func(o *Options) error {
+			if len(o.Emails) == 0 {
+				return fmt.Errorf("-profile %s requires at least one -email", profileSMIME)
+			}
+			if o.CNFromSPIFFE {
+				return fmt.Errorf("-profile %s certificates carry no SPIFFE ID, drop -cn-from-spiffe", profileSMIME)
+			}
+			return nil
+		},
+	},
+}
+
+// validateProfile checks that opts.Profile exists and its requirements hold.
+func validateProfile(opts *Options) error {
+	if opts.DBUser != "" && opts.Profile != profileDatabase {
+		return fmt.Errorf("-db-user requires -profile %s", profileDatabase)
+	}
+
+	if opts.DeviceID != "" && opts.Profile != profileIoT {
+		return fmt.Errorf("-device-id requires -profile %s", profileIoT)
+	}
+
+	if opts.Profile == "" {
+		return nil
+	}
+
+	p, ok := certProfiles[opts.Profile]
+	if !ok {
+		return fmt.Errorf("unknown -profile %q, must be one of: %s", opts.Profile, strings.Join(ProfileNames(), ", "))
+	}
+
+	if p.validate != nil {
+		return p.validate(opts)
+	}
+
+	return nil
+}
+
+// applyProfile adjusts the leaf template tpl to the profile selected in opts.
+func applyProfile(tpl *x509.Certificate, opts *Options) {
+	p, ok := certProfiles[opts.Profile]
+	if !ok {
+		return
+	}
+
+	tpl.KeyUsage = p.keyUsage
+	tpl.ExtKeyUsage = p.extKeyUsage
+	tpl.UnknownExtKeyUsage = p.unknownExtKeyUsage
+	tpl.ExtraExtensions = append(tpl.ExtraExtensions, p.extensions...)
+
+	if p.noSPIFFE {
+		tpl.URIs = nil
+	}
+
+	if p.noSANs {
+		tpl.URIs = nil
+		tpl.DNSNames = nil
+		tpl.IPAddresses = nil
+		tpl.EmailAddresses = nil
+	}
+
+	if p.commonName != nil {
+		tpl.Subject.CommonName = p.commonName(opts)
+	}
+}
+
+// ProfileNames returns the names accepted as Options.Profile, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(certProfiles))
+	for name := range certProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
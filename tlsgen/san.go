@@ -0,0 +1,161 @@
+package tlsgen
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+	// maxCIDRHostBits bounds -ip-cidr expansion to a /24 worth of addresses
+	maxCIDRHostBits = 8
+)
+
+// validateHostname checks that name is a syntactically valid DNS SAN entry.
+// The leftmost label may be a single "*" wildcard.
+func validateHostname(name string) error {
+	if name == "" {
+		return fmt.Errorf("invalid DNS SAN: empty name")
+	}
+
+	if len(name) > maxHostnameLength {
+		return fmt.Errorf("invalid DNS SAN %q: longer than %d characters", name, maxHostnameLength)
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if i == 0 && label == "*" {
+			if len(labels) < 2 {
+				return fmt.Errorf("invalid DNS SAN %q: wildcard must be followed by a domain", name)
+			}
+			continue
+		}
+
+		if err := validateLabel(label); err != nil {
+			return fmt.Errorf("invalid DNS SAN %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateConstraintDomain checks a name constraint domain given with flag.
+// A leading "." restricts it to subdomains, as in RFC 5280.
+func validateConstraintDomain(flag, domain string) error {
+	for _, label := range strings.Split(strings.TrimPrefix(domain, "."), ".") {
+		if err := validateLabel(label); err != nil {
+			return fmt.Errorf("invalid %s domain %q: %w", flag, domain, err)
+		}
+	}
+
+	return nil
+}
+
+func validateLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty label")
+	}
+
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q is longer than %d characters", label, maxLabelLength)
+	}
+
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q must not start or end with a hyphen", label)
+	}
+
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+		default:
+			return fmt.Errorf("label %q contains invalid character %q", label, c)
+		}
+	}
+
+	return nil
+}
+
+// expandCIDR returns every address in cidr, including the network and
+// broadcast addresses, refusing ranges with more than 2^maxCIDRHostBits entries.
+func expandCIDR(cidr string) ([]net.IP, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP range %q, %w", cidr, err)
+	}
+
+	ones, bits := network.Mask.Size()
+	if bits-ones > maxCIDRHostBits {
+		return nil, fmt.Errorf("IP range %q is too large, at most %d addresses are allowed", cidr, 1<<maxCIDRHostBits)
+	}
+
+	ips := make([]net.IP, 0, 1<<(bits-ones))
+	for ip := network.IP; network.Contains(ip); ip = nextIP(ip) {
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// nextIP returns a copy of ip incremented by one.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+// validateEmail checks that address is a bare rfc822Name, without display
+// name or angle brackets.
+func validateEmail(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		return fmt.Errorf("invalid email SAN %q", address)
+	}
+
+	return nil
+}
+
+// validateSANs checks the DNS, email and URI SANs of a leaf.
+func validateSANs(dnsNames, emails, uris []string) error {
+	for _, name := range dnsNames {
+		if err := validateHostname(name); err != nil {
+			return err
+		}
+	}
+
+	for _, email := range emails {
+		if err := validateEmail(email); err != nil {
+			return err
+		}
+	}
+
+	for _, uri := range uris {
+		if err := validateURI(uri); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateURI checks that uri is absolute, which RFC 5280 requires of a URI
+// SAN, e.g. https://example.com/id or urn:example:device:1.
+func validateURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+		return fmt.Errorf("invalid URI SAN %q, must be an absolute URI", uri)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package tlsgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateHostname(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		valid bool
+	}{
+		{"web.local.dev", true},
+		{"localhost", true},
+		{"*.local.dev", true},
+		{"xn--bcher-kva.example", true},
+		{strings.Repeat("a", maxLabelLength) + ".dev", true},
+		{"", false},
+		{"*", false},
+		{"web.*.dev", false},
+		{"web..dev", false},
+		{"web.local.dev.", false},
+		{"-web.dev", false},
+		{"web-.dev", false},
+		{"web_1.dev", false},
+		{"bücher.example", false},
+		{strings.Repeat("a", maxLabelLength+1) + ".dev", false},
+		{strings.Repeat("a.", maxHostnameLength/2) + "dev", false},
+	} {
+		err := validateHostname(tc.name)
+		if tc.valid && err != nil {
+			t.Errorf("%q was rejected, %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%q was accepted", tc.name)
+		}
+	}
+}
+
+func TestExpandCIDR(t *testing.T) {
+	for _, tc := range []struct {
+		cidr        string
+		first, last string
+		count       int
+	}{
+		{"10.0.0.7/32", "10.0.0.7", "10.0.0.7", 1},
+		{"10.0.0.0/30", "10.0.0.0", "10.0.0.3", 4},
+		{"10.0.0.9/30", "10.0.0.8", "10.0.0.11", 4},
+		{"10.0.0.0/24", "10.0.0.0", "10.0.0.255", 256},
+		{"fd00::1/128", "fd00::1", "fd00::1", 1},
+		{"fd00::/126", "fd00::", "fd00::3", 4},
+		{"fd00::ff00/120", "fd00::ff00", "fd00::ffff", 256},
+	} {
+		t.Run(tc.cidr, func(t *testing.T) {
+			ips, err := expandCIDR(tc.cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ips) != tc.count {
+				t.Fatalf("got %d addresses, want %d", len(ips), tc.count)
+			}
+			if first, last := ips[0].String(), ips[len(ips)-1].String(); first != tc.first || last != tc.last {
+				t.Fatalf("got %s to %s, want %s to %s", first, last, tc.first, tc.last)
+			}
+		})
+	}
+
+	for _, cidr := range []string{"10.0.0.0/23", "10.0.0.0/8", "fd00::/119", "fd00::/64", "10.0.0.1", "10.0.0.0/33", "fd00::/129"} {
+		if _, err := expandCIDR(cidr); err == nil {
+			t.Errorf("%q was accepted", cidr)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package tlsgen
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// INSECURE: everything in this file exists to make test fixtures
+// reproducible. Anyone who knows the seed can recreate the private keys.
+
+// random returns the randomness source for label. Without a seed that's
+// crypto/rand, with one it's a reproducible stream unique to the label.
+func (o *Options) random(label string) io.Reader {
+	if o.Seed == nil {
+		return rand.Reader
+	}
+
+	return seededReader(o.Seed, label)
+}
+
+// seededReader returns an endless deterministic stream: AES-256-CTR keyed
+// with HMAC-SHA256(seed, label), encrypting zeroes.
+func seededReader(seed []byte, label string) io.Reader {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte(label))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		// can't happen, the key is always 32 bytes
+		panic(err)
+	}
+
+	return cipher.StreamReader{
+		S: cipher.NewCTR(block, make([]byte, aes.BlockSize)),
+		R: zeroReader{},
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// seededRSAKey generates an RSA key that only depends on the bytes read from
+// r. rsa.GenerateKey can't be used for that, it deliberately consumes a
+// random amount of its input.
+func seededRSAKey(r io.Reader, bits int) (*rsa.PrivateKey, error) {
+	one := big.NewInt(1)
+	e := big.NewInt(65537)
+
+	for {
+		p, err := seededPrime(r, bits/2)
+		if err != nil {
+			return nil, err
+		}
+
+		q, err := seededPrime(r, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		n := new(big.Int).Mul(p, q)
+		if n.BitLen() != bits {
+			continue
+		}
+
+		totient := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, totient)
+		if d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("seeded key is invalid, %w", err)
+		}
+
+		return key, nil
+	}
+}
+
+// seededPrime reads candidates from r until one of them is a prime of the
+// given bit length. The top two bits are set, so the product of two such
+// primes has the full length.
+func seededPrime(r io.Reader, bits int) (*big.Int, error) {
+	if bits < 16 {
+		return nil, fmt.Errorf("prime size must be at least 16 bits")
+	}
+
+	b := make([]byte, (bits+7)/8)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		// clear the bits above the requested length
+		if excess := len(b)*8 - bits; excess > 0 {
+			b[0] &= 0xff >> excess
+		}
+
+		p := new(big.Int).SetBytes(b)
+		p.SetBit(p, bits-1, 1)
+		p.SetBit(p, bits-2, 1)
+		p.SetBit(p, 0, 1)
+
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
+
+// seededECDSAKey derives an ECDSA key on curve from the bytes read from r.
+// ecdsa.GenerateKey deliberately consumes a random amount of its input, too.
+func seededECDSAKey(r io.Reader, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	params := curve.Params()
+
+	// 64 extra bits make the bias of the reduction negligible, as in FIPS
+	// 186-5 A.2.1
+	b := make([]byte, (params.BitSize+7)/8+8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	nMinusOne := new(big.Int).Sub(params.N, big.NewInt(1))
+	d := new(big.Int).SetBytes(b)
+	d.Mod(d, nMinusOne)
+	d.Add(d, big.NewInt(1))
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, (params.BitSize+7)/8)))
+
+	return key, nil
+}
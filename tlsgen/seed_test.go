@@ -0,0 +1,98 @@
+package tlsgen
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSeededReader(t *testing.T) {
+	read := func(seed, label string) []byte {
+		b := make([]byte, 64)
+		if _, err := io.ReadFull(seededReader([]byte(seed), label), b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if !bytes.Equal(read("seed", "root"), read("seed", "root")) {
+		t.Fatal("same seed and label gave different streams")
+	}
+	if bytes.Equal(read("seed", "root"), read("seed", "leaf")) {
+		t.Fatal("different labels gave the same stream")
+	}
+	if bytes.Equal(read("seed", "root"), read("other", "root")) {
+		t.Fatal("different seeds gave the same stream")
+	}
+}
+
+func TestSeededKey(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			generate := func(seed string, root bool, index int) []byte {
+				opts := DefaultOptions()
+				opts.Seed, opts.Index, opts.KeyType = []byte(seed), index, keyType
+				key, err := generateKey(&opts, opts.certLabel(root))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				der, err := x509.MarshalPKIXPublicKey(key.Public())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return der
+			}
+
+			root := generate("seed", true, 0)
+			if !bytes.Equal(root, generate("seed", true, 0)) {
+				t.Fatal("same seed gave different keys")
+			}
+			if bytes.Equal(root, generate("other", true, 0)) {
+				t.Fatal("different seeds gave the same key")
+			}
+
+			leaf := generate("seed", false, 0)
+			if bytes.Equal(root, leaf) {
+				t.Fatal("root and leaf got the same key from one seed")
+			}
+			if bytes.Equal(leaf, generate("seed", false, 2)) {
+				t.Fatal("leaves of a bulk run got the same key")
+			}
+		})
+	}
+}
+
+func TestSeededCertificate(t *testing.T) {
+	for _, keyType := range []string{KeyTypeRSA, KeyTypeEd25519} {
+		t.Run(keyType, func(t *testing.T) {
+			generate := func(start time.Time) (root, leaf []byte) {
+				opts := DefaultOptions()
+				opts.Seed, opts.KeyType, opts.StartTime = []byte("seed"), keyType, start
+				ca, err := GenerateRootCA(&opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				l, err := GenerateLeaf(ca, &opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return ca.CertPEM, l.CertPEM
+			}
+
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			root, leaf := generate(start)
+			root2, leaf2 := generate(start)
+			if !bytes.Equal(root, root2) || !bytes.Equal(leaf, leaf2) {
+				t.Fatal("same seed and start time gave different certificates")
+			}
+
+			if root2, _ = generate(start.Add(time.Hour)); bytes.Equal(root, root2) {
+				t.Fatal("a different start time gave the same certificate")
+			}
+		})
+	}
+}
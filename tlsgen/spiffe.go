@@ -0,0 +1,78 @@
+package tlsgen
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxTrustDomainLength is the SPIFFE ID specification's trust domain bound.
+const maxTrustDomainLength = 255
+
+// newSPIFFEID builds spiffe://<domain>/<path> and makes sure it's a valid
+// SPIFFE ID that round-trips through url.Parse unchanged, so no broken URI
+// ends up in a certificate.
+func newSPIFFEID(domain, path string) (*url.URL, error) {
+	if err := validateTrustDomain(domain); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateSPIFFEPath(path); err != nil {
+		return nil, err
+	}
+
+	id := "spiffe://" + domain + "/" + path
+	u, err := url.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE ID %q, %w", id, err)
+	}
+
+	if u.Scheme != "spiffe" || u.Host != domain || u.Path != "/"+path || u.String() != id {
+		return nil, fmt.Errorf("invalid SPIFFE ID %q, it doesn't round-trip as a URI", id)
+	}
+
+	return u, nil
+}
+
+// validateTrustDomain checks domain against the SPIFFE trust domain charset,
+// lowercase letters, digits, ".", "-" and "_".
+func validateTrustDomain(domain string) error {
+	if domain == "" {
+		return fmt.Errorf("invalid SPIFFE trust domain: empty name")
+	}
+
+	if len(domain) > maxTrustDomainLength {
+		return fmt.Errorf("invalid SPIFFE trust domain %q: longer than %d characters", domain, maxTrustDomainLength)
+	}
+
+	for _, c := range domain {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return fmt.Errorf("invalid SPIFFE trust domain %q: character %q isn't allowed, use lowercase letters, digits, '.', '-' and '_'", domain, c)
+		}
+	}
+
+	return nil
+}
+
+// ValidateSPIFFEPath checks the workload path of a SPIFFE ID, without the
+// leading "/". Segments must not be empty, "." or "..", and may only hold
+// letters, digits, ".", "-" and "_", percent-encoding isn't allowed.
+func ValidateSPIFFEPath(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid SPIFFE ID path %q: empty, \".\" or \"..\" segment", path)
+		}
+
+		for _, c := range segment {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+			default:
+				return fmt.Errorf("invalid SPIFFE ID path %q: character %q isn't allowed, use letters, digits, '.', '-' and '_'", path, c)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package tlsgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTrustDomain(t *testing.T) {
+	for _, tc := range []struct {
+		domain string
+		valid  bool
+	}{
+		{"example.org", true},
+		{"cluster.local", true},
+		{"my_domain-1.dev", true},
+		{strings.Repeat("a", maxTrustDomainLength), true},
+		{"", false},
+		{"Example.org", false},
+		{"example.org:8443", false},
+		{"example.org/ns", false},
+		{"user@example.org", false},
+		{"exämple.org", false},
+		{strings.Repeat("a", maxTrustDomainLength+1), false},
+	} {
+		err := validateTrustDomain(tc.domain)
+		if tc.valid && err != nil {
+			t.Errorf("%q was rejected, %v", tc.domain, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%q was accepted", tc.domain)
+		}
+	}
+}
+
+func TestValidateSPIFFEPath(t *testing.T) {
+	for _, tc := range []struct {
+		path  string
+		valid bool
+	}{
+		{"web", true},
+		{"ns/default/sa/web", true},
+		{"Web.v1_x-y", true},
+		{"", false},
+		{"ns//web", false},
+		{"ns/web/", false},
+		{"ns/../web", false},
+		{"./web", false},
+		{"web%2Fapi", false},
+		{"web api", false},
+		{"web?x=1", false},
+	} {
+		err := ValidateSPIFFEPath(tc.path)
+		if tc.valid && err != nil {
+			t.Errorf("%q was rejected, %v", tc.path, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%q was accepted", tc.path)
+		}
+	}
+}
+
+func TestNewSPIFFEID(t *testing.T) {
+	u, err := newSPIFFEID("example.org", "ns/default/sa/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.String(); got != "spiffe://example.org/ns/default/sa/web" {
+		t.Fatalf("got %q", got)
+	}
+
+	if _, err := newSPIFFEID("Example.org", "web"); err == nil {
+		t.Fatal("invalid trust domain was accepted")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+// validatePair checks that the certificate and key at certPath and keyPath
+// belong together, that the certificate is currently valid and that it
+// chains up to a CA found in caPath. An encrypted key is decrypted with
+// password. Unless allowSelfSigned is set, a
+// certificate that signed itself is rejected, as it trivially verifies when
+// it is also present in caPath.
+func validatePair(certPath, keyPath, caPath, password string, allowSelfSigned bool) error {
+	pair, err := loadKeyPair(certPath, keyPath, password)
+	if err != nil {
+		return fmt.Errorf("couldn't load key pair, %w", err)
+	}
+	fmt.Printf("Key pair:     OK, %q matches %q\n", keyPath, certPath)
+
+	chain := make([]*x509.Certificate, 0, len(pair.Chain))
+	for _, der := range pair.Chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%q contains errors, %w", certPath, err)
+		}
+		chain = append(chain, cert)
+	}
+	leaf := chain[0]
+
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate %q expired on %s", certPath, leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid before %s", certPath, leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	fmt.Printf("Validity:     OK, until %s\n", leaf.NotAfter.UTC().Format(time.RFC3339))
+
+	if !allowSelfSigned && isSelfSigned(leaf) {
+		return fmt.Errorf("certificate %q is self-signed, expected a leaf issued by %q", certPath, caPath)
+	}
+
+	roots, err := tlsgen.LoadCertPool(caPath)
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate %q doesn't verify against %q, %w", certPath, caPath, err)
+	}
+	fmt.Printf("Verification: OK, issued by %s\n", leaf.Issuer)
+
+	return nil
+}
+
+// isSelfSigned reports whether cert names itself as issuer and carries a
+// signature made with its own key.
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+
+	// CheckSignatureFrom would refuse non-CA certificates as the parent
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// validateBulk checks every leaf of a -count bulk run against caPath with
+// validatePair and reports all failures together.
+func validateBulk(opts *options, caPath string, allowSelfSigned bool) error {
+	if opts.timestampDir {
+		opts.generation = filepath.Join(clientDir(), currentLink)
+	}
+
+	var errs []error
+	for i := 1; i <= opts.count; i++ {
+		leafOpts := *opts
+		leafOpts.Index = i
+
+		certPath, keyPath := leafPaths(&leafOpts)
+		if err := validatePair(certPath, keyPath, caPath, opts.keyPassword, allowSelfSigned); err != nil {
+			errs = append(errs, fmt.Errorf("certificate %d: %w", i, err))
+		}
+	}
+
+	fmt.Printf("Verified %d of %d certificates\n", opts.count-len(errs), opts.count)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rumenvasilev/tlsgen-dev/tlsgen"
+)
+
+var verifyUsages = map[string]x509.ExtKeyUsage{
+	"any":    x509.ExtKeyUsageAny,
+	"server": x509.ExtKeyUsageServerAuth,
+	"client": x509.ExtKeyUsageClientAuth,
+}
+
+// verifyLeaf verifies the leaf in opts against the root CA, using the
+// intermediates from the leaf file and the -intermediate CA, and prints the
+// resulting chain. dnsName, when set, must be covered by the leaf's SANs. A
+// self-signed leaf is rejected unless allowSelfSigned is set, as the root CA
+// itself would trivially verify.
+func verifyLeaf(w io.Writer, opts *options, usage, dnsName string, allowSelfSigned bool) error {
+	keyUsage, ok := verifyUsages[usage]
+	if !ok {
+		return fmt.Errorf("unknown -verify-usage %q, use any, server or client", usage)
+	}
+
+	if opts.timestampDir {
+		opts.generation = filepath.Join(clientDir(), currentLink)
+	}
+	certPath, _ := leafPaths(opts)
+	rootPath := rootCertPath()
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read %q, %w", certPath, err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %q, %w", certPath, err)
+	}
+
+	if !allowSelfSigned && isSelfSigned(certs[0]) {
+		return fmt.Errorf("certificate %q is self-signed, expected a leaf issued by %q", certPath, rootPath)
+	}
+
+	roots, err := tlsgen.LoadCertPool(rootPath)
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	data, err = os.ReadFile(filepath.Join(tlsDir, intermediateCAFilePath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("couldn't read intermediate CA, %w", err)
+	}
+	intermediates.AppendCertsFromPEM(data)
+
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       dnsName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{keyUsage},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate %q doesn't verify against %q, %s", certPath, rootPath, describeVerifyError(err))
+	}
+
+	fmt.Fprintf(w, "Verified %q:\n", certPath)
+	for i, cert := range chains[0] {
+		fmt.Fprintf(w, "%*s%d: %s, valid until %s\n", i*2, "", i, cert.Subject, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// describeVerifyError explains the common verification failures in terms of
+// what to change.
+func describeVerifyError(err error) string {
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+
+	switch {
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return fmt.Sprintf("%s is expired or not yet valid, regenerate it", invalid.Cert.Subject)
+	case errors.As(err, &invalid) && invalid.Reason == x509.IncompatibleUsage:
+		return "the extended key usage doesn't allow the requested -verify-usage"
+	case errors.As(err, &unknown):
+		return "it isn't signed by this root CA, or an intermediate is missing"
+	case errors.As(err, &hostname):
+		return fmt.Sprintf("%s, add it with -dns", hostname.Error())
+	}
+
+	return err.Error()
+}